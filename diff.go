@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s diff [OPTIONS] DEPLOY_ID\nOptions:\n", versionInfo(), os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	checkFormat(fs, *format, "text", "json")
+
+	aws := watch.NewAwsEnv()
+	deployment, err := aws.GetDeployment(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting deployment: %v\n", err)
+		os.Exit(1)
+	}
+
+	previous, err := watch.PreviousSuccessfulDeployment(aws, deployment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting previous deployment: %v\n", err)
+		os.Exit(1)
+	}
+
+	diff := watch.NewRevisionDiff(deployment, previous)
+	switch *format {
+	case "json":
+		err = watch.WriteRevisionDiffJson(os.Stdout, diff)
+	default:
+		err = watch.WriteRevisionDiffText(os.Stdout, diff)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing diff: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// ExecHooks runs local shell commands when transitions happen. Details of
+// the transition are passed as DEPLOYWATCH_* environment variables and as
+// json on stdin.
+type ExecHooks struct {
+	commands map[watch.TransitionKind][]string
+	timeout  time.Duration
+	sem      chan bool
+	logger   *log.Logger
+}
+
+// NewExecHooks creates exec hooks that time out commands after timeout,
+// running at most concurrency commands at once
+func NewExecHooks(timeout time.Duration, concurrency int, logger *log.Logger) *ExecHooks {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &ExecHooks{
+		map[watch.TransitionKind][]string{},
+		timeout,
+		make(chan bool, concurrency),
+		logger,
+	}
+}
+
+// Add runs command whenever a transition of kind happens
+func (e *ExecHooks) Add(kind watch.TransitionKind, command string) {
+	if command == "" {
+		return
+	}
+	e.commands[kind] = append(e.commands[kind], command)
+}
+
+func (e *ExecHooks) Len() int {
+	return len(e.commands)
+}
+
+// Notify runs the commands for the transition in the background
+func (e *ExecHooks) Notify(t *watch.Transition) {
+	for _, command := range e.commands[t.Kind] {
+		go func(command string) {
+			output, err := e.Run(command, t)
+			if err != nil {
+				e.logger.Printf("Error running %s hook %q: %s: %s\n", t.Kind, command, err, strings.TrimSpace(string(output)))
+			} else {
+				e.logger.Printf("Ran %s hook %q\n", t.Kind, command)
+			}
+		}(command)
+	}
+}
+
+// Run runs a single command for the transition, waiting for a free slot
+// if too many commands are already running, and returns its output
+func (e *ExecHooks) Run(command string, t *watch.Transition) ([]byte, error) {
+	e.sem <- true
+	defer func() { <-e.sem }()
+
+	stdin, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), transitionEnv(t)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// run in its own process group, so the whole command can be killed
+	// when it times out, not just the shell
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if e.timeout > 0 {
+		timeout = time.After(e.timeout)
+	}
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = fmt.Errorf("timed out after %s", e.timeout)
+	}
+
+	return output.Bytes(), err
+}
+
+func transitionEnv(t *watch.Transition) []string {
+	return []string{
+		"DEPLOYWATCH_EVENT=" + string(t.Kind),
+		"DEPLOYWATCH_TIME=" + t.Time.Format(time.RFC3339),
+		"DEPLOYWATCH_DEPLOYMENT_ID=" + t.DeploymentId,
+		"DEPLOYWATCH_APPLICATION_NAME=" + t.ApplicationName,
+		"DEPLOYWATCH_DEPLOYMENT_GROUP_NAME=" + t.DeploymentGroupName,
+		"DEPLOYWATCH_STATUS=" + t.Status,
+		"DEPLOYWATCH_INSTANCE_ID=" + t.InstanceId,
+		"DEPLOYWATCH_INSTANCE_NAME=" + t.InstanceName,
+		"DEPLOYWATCH_LIFECYCLE_EVENT=" + t.LifecycleEventName,
+		"DEPLOYWATCH_MESSAGE=" + t.Message,
+	}
+}
+
+// registerExecHooks runs the commands named by the cli flags on renderer transitions
+func registerExecHooks(renderer *watch.Renderer, logger *log.Logger) {
+	hooks := NewExecHooks(*hookTimeoutFlag, *hookConcurrencyFlag, logger)
+	hooks.Add(watch.DeploymentStarted, *onStartFlag)
+	hooks.Add(watch.DeploymentSucceeded, *onSuccessFlag)
+	hooks.Add(watch.DeploymentFailed, *onFailFlag)
+	hooks.Add(watch.DeploymentStopped, *onStopFlag)
+	hooks.Add(watch.LifecycleEventFailed, *onHookFailFlag)
+	hooks.Add(watch.InstanceStuck, *onStuckFlag)
+	hooks.Add(watch.InstanceUnhealthy, *onUnhealthyFlag)
+	hooks.Add(watch.AlarmTriggered, *onAlarmFlag)
+
+	if hooks.Len() > 0 {
+		renderer.OnTransition(hooks.Notify)
+	}
+}
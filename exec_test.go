@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func TestExecHooksRun(t *testing.T) {
+	hooks := NewExecHooks(time.Second, 1, log.New(ioutil.Discard, "", 0))
+
+	output, err := hooks.Run(`echo "$DEPLOYWATCH_EVENT $DEPLOYWATCH_INSTANCE_NAME"; cat`, testTransition())
+	if err != nil {
+		t.Fatalf("Run() => %s", err)
+	}
+
+	lines := strings.SplitN(string(output), "\n", 2)
+	if lines[0] != "lifecycle_event.failed web-1" {
+		t.Errorf("Run() env => %q", lines[0])
+	}
+
+	var transition watch.Transition
+	err = json.Unmarshal([]byte(lines[1]), &transition)
+	if err != nil || transition.DeploymentId != "d-1" || transition.LifecycleEventName != "ValidateService" {
+		t.Errorf("Run() stdin => %q %v", lines[1], err)
+	}
+
+	_, err = hooks.Run("exit 3", testTransition())
+	if err == nil {
+		t.Errorf("Run() should fail when the command fails")
+	}
+}
+
+func TestExecHooksTimeout(t *testing.T) {
+	hooks := NewExecHooks(100*time.Millisecond, 1, log.New(ioutil.Discard, "", 0))
+
+	start := time.Now()
+	_, err := hooks.Run("sleep 5", testTransition())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() => %v, want timeout", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Run() took %s, should have been killed", time.Since(start))
+	}
+}
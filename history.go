@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func historyMain(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	name := fs.String("name", "", "CodeDeploy application name")
+	group := fs.String("group", "", "CodeDeploy deployment group name")
+	since := fs.Duration("since", 7*24*time.Hour, "Analyze deployments created within this duration")
+	limit := fs.Int("max", 20, "Maximum number of deployments to analyze (0 for no limit)")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s history [OPTIONS]\nOptions:\n", versionInfo(), os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *name == "" || *group == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	checkFormat(fs, *format, "table", "json")
+
+	end := time.Now()
+	start := end.Add(-*since)
+
+	h, err := watch.AnalyzeHistory(watch.NewAwsEnv(), *name, *group, start, end, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error analyzing history: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "json":
+		err = watch.WriteHistoryJson(os.Stdout, h)
+	default:
+		err = watch.WriteHistoryTable(os.Stdout, h)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing history: %v\n", err)
+		os.Exit(1)
+	}
+}
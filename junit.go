@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// JunitTestSuites is a JUnit XML report of watched deployments, with a
+// testsuite per deployment and a testcase per instance, so that CI
+// systems show failed instances as failed tests
+type JunitTestSuites struct {
+	XMLName    xml.Name          `xml:"testsuites"`
+	Tests      int               `xml:"tests,attr"`
+	Failures   int               `xml:"failures,attr"`
+	Time       int               `xml:"time,attr"`
+	TestSuites []*JunitTestSuite `xml:"testsuite"`
+}
+
+type JunitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       int              `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties []*JunitProperty `xml:"properties>property"`
+	TestCases  []*JunitTestCase `xml:"testcase"`
+}
+
+type JunitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type JunitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      int           `xml:"time,attr"`
+	Failures  []*JunitFault `xml:"failure"`
+	Skipped   *JunitFault   `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type JunitFault struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// NewJunitReport converts a snapshot to a JUnit XML report. Instances
+// that had not finished are reported as skipped.
+func NewJunitReport(snapshot *watch.Snapshot) *JunitTestSuites {
+	report := &JunitTestSuites{TestSuites: []*JunitTestSuite{}}
+
+	for _, d := range snapshot.Deployments {
+		suite := &JunitTestSuite{
+			Name: fmt.Sprintf("%s-%s %s", d.ApplicationName, d.DeploymentGroupName, d.DeploymentId),
+			Properties: []*JunitProperty{
+				{"deploymentId", d.DeploymentId},
+				{"applicationName", d.ApplicationName},
+				{"deploymentGroupName", d.DeploymentGroupName},
+				{"deploymentConfigName", d.DeploymentConfigName},
+				{"status", d.Status},
+			},
+			TestCases: []*JunitTestCase{},
+		}
+		if d.CreateTime != nil {
+			suite.Timestamp = d.CreateTime.UTC().Format(time.RFC3339)
+		}
+		if d.ErrorMessage != "" {
+			suite.Properties = append(suite.Properties, &JunitProperty{"errorMessage", d.ErrorMessage})
+		}
+
+		for _, i := range d.Instances {
+			testCase := junitTestCase(d, i)
+			suite.Tests += 1
+			suite.Time += testCase.Time
+			if len(testCase.Failures) > 0 {
+				suite.Failures += 1
+			}
+			if testCase.Skipped != nil {
+				suite.Skipped += 1
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Time += suite.Time
+		report.TestSuites = append(report.TestSuites, suite)
+	}
+
+	return report
+}
+
+func junitTestCase(d *watch.DeploymentSnapshot, i *watch.InstanceSnapshot) *JunitTestCase {
+	name := i.InstanceId
+	if i.Name != "" {
+		name = fmt.Sprintf("%s (%s)", i.Name, i.InstanceId)
+	}
+
+	testCase := &JunitTestCase{
+		ClassName: fmt.Sprintf("%s.%s", d.ApplicationName, d.DeploymentGroupName),
+		Name:      name,
+		Time:      i.Duration,
+		Failures:  []*JunitFault{},
+	}
+
+	lines := []string{}
+	for _, e := range i.LifecycleEvents {
+		lines = append(lines, fmt.Sprintf("%s %s %s", e.Name, e.Status, watch.DurationStr(e.Duration)))
+
+		if e.Status != "Failed" {
+			continue
+		}
+
+		fault := &JunitFault{Message: e.Name + " failed"}
+		if e.Diagnostics != nil {
+			fault.Type = e.Diagnostics.ErrorCode
+			if e.Diagnostics.Message != "" {
+				fault.Message = fmt.Sprintf("%s failed: %s", e.Name, e.Diagnostics.Message)
+			}
+			fault.Text = e.Diagnostics.LogTail
+		}
+		testCase.Failures = append(testCase.Failures, fault)
+	}
+	testCase.SystemOut = strings.Join(lines, "\n")
+
+	if len(testCase.Failures) == 0 {
+		switch i.Status {
+		case "Succeeded":
+		case "Failed":
+			testCase.Failures = append(testCase.Failures, &JunitFault{Message: "instance failed"})
+		default:
+			testCase.Skipped = &JunitFault{Message: i.Status}
+		}
+	}
+
+	return testCase
+}
+
+// WriteJunit writes the snapshot as a JUnit XML report
+func WriteJunit(w io.Writer, snapshot *watch.Snapshot) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(NewJunitReport(snapshot))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeJunitFile writes the renderer's current state as a JUnit XML report to path
+func writeJunitFile(path string, renderer *watch.Renderer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = WriteJunit(f, renderer.Snapshot())
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func TestNewJunitReport(t *testing.T) {
+	snapshot := &watch.Snapshot{Deployments: []*watch.DeploymentSnapshot{
+		{
+			DeploymentId:        "d-1",
+			ApplicationName:     "web",
+			DeploymentGroupName: "prod",
+			Status:              "Failed",
+			Instances: []*watch.InstanceSnapshot{
+				{InstanceId: "i-1", Name: "web-1", Status: "Succeeded", Duration: 30},
+				{InstanceId: "i-2", Status: "Failed", Duration: 12, LifecycleEvents: []*watch.LifecycleEventSnapshot{
+					{Name: "ApplicationStart", Status: "Succeeded", Duration: 10},
+					{Name: "ValidateService", Status: "Failed", Duration: 2, Diagnostics: &watch.DiagnosticsSnapshot{
+						ErrorCode: "ScriptFailed",
+						Message:   "Script at specified location: validate.sh run as user root failed with exit code 1",
+						LogTail:   "curl: (7) Failed to connect",
+					}},
+				}},
+				{InstanceId: "i-3", Status: "Pending"},
+			},
+		},
+	}}
+
+	report := NewJunitReport(snapshot)
+	if report.Tests != 3 || report.Failures != 1 || report.Time != 42 {
+		t.Errorf("NewJunitReport() => tests %d failures %d time %d", report.Tests, report.Failures, report.Time)
+	}
+
+	suite := report.TestSuites[0]
+	if suite.Name != "web-prod d-1" || suite.Skipped != 1 {
+		t.Errorf("NewJunitReport() suite => %s skipped %d", suite.Name, suite.Skipped)
+	}
+
+	testCases := suite.TestCases
+	if testCases[0].Name != "web-1 (i-1)" || len(testCases[0].Failures) != 0 || testCases[0].Skipped != nil {
+		t.Errorf("NewJunitReport() succeeded testcase => %+v", testCases[0])
+	}
+	if len(testCases[1].Failures) != 1 {
+		t.Fatalf("NewJunitReport() failed testcase => %+v", testCases[1])
+	}
+	failure := testCases[1].Failures[0]
+	if failure.Type != "ScriptFailed" || !strings.HasPrefix(failure.Message, "ValidateService failed: Script") || failure.Text != "curl: (7) Failed to connect" {
+		t.Errorf("NewJunitReport() failure => %+v", failure)
+	}
+	if testCases[2].Skipped == nil || testCases[2].Skipped.Message != "Pending" {
+		t.Errorf("NewJunitReport() pending testcase => %+v", testCases[2])
+	}
+
+	var b bytes.Buffer
+	err := WriteJunit(&b, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<failure message="ValidateService failed: Script`) {
+		t.Errorf("WriteJunit() => %s", b.String())
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/atongen/deploywatch/watch"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gizak/termui"
+)
+
+// logPaneLines is how many log lines the log pane shows
+const logPaneLines = 15
+
+// logSourcesFromFlags parses the log sources given by the cli flags
+func logSourcesFromFlags() (watch.LogSources, error) {
+	sources := watch.LogSources{}
+	for _, value := range logsFlag {
+		application, source, err := watch.ParseLogSource(value)
+		if err != nil {
+			return nil, err
+		}
+		sources[application] = source
+	}
+	return sources, nil
+}
+
+// registerAgentLogs fetches the agent logs of failed instances of the
+// applications named by the cli flags
+func registerAgentLogs(aws watch.Aws, renderer *watch.Renderer, logger *log.Logger) {
+	if *agentLogsFlag == "" {
+		return
+	}
+
+	fetcher := watch.NewAgentLogFetcher(aws, renderer, logger, strings.Split(*agentLogsFlag, ","), *agentConcurrencyFlag)
+	fetcher.Lines = *agentLogLinesFlag
+	fetcher.Dir = *agentLogDirFlag
+	renderer.OnTransition(fetcher.Notify)
+}
+
+// logPane shows the agent log fetched from the selected instance, or else
+// tails its CloudWatch logs, below the deployments
+type logPane struct {
+	Par        *termui.Par
+	aws        watch.Aws
+	renderer   *watch.Renderer
+	sources    watch.LogSources
+	instanceId string
+	tailer     *watch.LogTailer
+	agentLog   bool
+	open       bool
+	mu         sync.Mutex
+}
+
+func newLogPane(aws watch.Aws, renderer *watch.Renderer, sources watch.LogSources) *logPane {
+	par := termui.NewPar("")
+	par.Height = logPaneLines + 2
+	par.TextFgColor = termui.ColorWhite
+	par.BorderFg = termui.ColorBlue
+
+	return &logPane{
+		par,
+		aws,
+		renderer,
+		sources,
+		"",
+		nil,
+		false,
+		false,
+		sync.Mutex{},
+	}
+}
+
+// Toggle opens the pane on the selected instance, or closes it
+func (p *logPane) Toggle() bool {
+	p.mu.Lock()
+	p.open = !p.open
+	open := p.open
+	p.instanceId = ""
+	p.tailer = nil
+	p.mu.Unlock()
+
+	if open {
+		p.Follow()
+	}
+	return open
+}
+
+// Follow switches an open pane to the selected instance
+func (p *logPane) Follow() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.open {
+		return
+	}
+
+	deployment, instanceId := p.renderer.Selected()
+	if deployment == nil {
+		p.instanceId = ""
+		p.tailer = nil
+		p.setText("Logs", "select an instance with j and k")
+		return
+	}
+	if instanceId == p.instanceId {
+		return
+	}
+	p.instanceId = instanceId
+	p.tailer = nil
+	p.agentLog = false
+
+	if agentLog := p.renderer.AgentLog(instanceId); agentLog != nil {
+		p.showAgentLog(agentLog)
+		return
+	}
+
+	application := aws.StringValue(deployment.ApplicationName)
+	source := p.sources.Source(application)
+	if source == nil {
+		p.tailer = nil
+		p.setText("Logs "+instanceId, fmt.Sprintf("no log source for %s, see -logs", application))
+		return
+	}
+
+	p.tailer = watch.NewLogTailer(p.aws, source, deployment, instanceId, logPaneLines)
+	p.setText(fmt.Sprintf("Logs %s %s", instanceId, source.Group), "loading...")
+}
+
+func (p *logPane) setText(label, text string) {
+	p.Par.BorderLabel = label
+	termui.SendCustomEvt("/usr/logs", text)
+}
+
+func (p *logPane) showAgentLog(agentLog *watch.AgentLog) {
+	p.agentLog = true
+	lines := strings.Split(strings.TrimRight(agentLog.Output, "\n"), "\n")
+	if len(lines) > logPaneLines {
+		lines = lines[len(lines)-logPaneLines:]
+	}
+	p.setText(fmt.Sprintf("Agent log %s %s", agentLog.InstanceId, agentLog.Status), strings.Join(lines, "\n"))
+}
+
+// Poll tails the logs of the instance the pane is open on, switching to
+// its agent log once that is fetched
+func (p *logPane) Poll() {
+	p.mu.Lock()
+	if !p.open {
+		p.mu.Unlock()
+		return
+	}
+	tailer := p.tailer
+	if p.instanceId != "" && !p.agentLog {
+		if agentLog := p.renderer.AgentLog(p.instanceId); agentLog != nil {
+			p.tailer = nil
+			p.showAgentLog(agentLog)
+			tailer = nil
+		}
+	}
+	p.mu.Unlock()
+
+	if tailer == nil {
+		return
+	}
+
+	lines, err := tailer.Poll()
+	if err != nil {
+		lines = append(lines, "error: "+err.Error())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the pane may have moved on while polling
+	if p.tailer == tailer {
+		termui.SendCustomEvt("/usr/logs", strings.Join(lines, "\n"))
+	}
+}
+
+// IsOpen is true while the pane is shown
+func (p *logPane) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open
+}
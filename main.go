@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/atongen/deploywatch/watch"
 	"github.com/gizak/termui"
 )
 
@@ -22,21 +26,150 @@ var (
 
 // cli flags
 var (
-	nameFlag        = flag.String("name", "", "CodeDeploy application name (optional)")
-	groupsFlag      = flag.String("groups", "", "CodeDeploy deployment groups csv (optional)")
-	compactFlag     = flag.Bool("compact", false, "Print compact output")
-	hideSuccessFlag = flag.Bool("hide-success", false, "Do not print instances once they are successfully deployed")
-	logFileFlag     = flag.String("log-file", "/tmp/deploywatch.log", "Location of log file")
-	versionFlag     = flag.Bool("version", false, "Print version information and exit")
+	nameFlag               = flag.String("name", "", "CodeDeploy application name (optional)")
+	groupsFlag             = flag.String("groups", "", "CodeDeploy deployment groups csv (optional)")
+	compactFlag            = flag.Bool("compact", false, "Print compact output")
+	hideSuccessFlag        = flag.Bool("hide-success", false, "Do not print instances once they are successfully deployed")
+	logFileFlag            = flag.String("log-file", "/tmp/deploywatch.log", "Location of log file")
+	slowFactorFlag         = flag.Float64("slow-factor", 3.0, "Flag instances whose current lifecycle event takes this multiple of the peer median (0 to disable)")
+	stuckAfterFlag         = flag.Duration("stuck-after", 15*time.Minute, "Flag instances whose current lifecycle event takes longer than this as stuck (0 to disable)")
+	historyFlag            = flag.Duration("history", 0, "Estimate ETAs from deployment group history within this duration (optional)")
+	timelineFlag           = flag.Bool("timeline", false, "Start in the timeline view (press t to toggle)")
+	webhookEventsFlag      = flag.String("webhook-events", "", "Webhook events csv (optional, default all): "+transitionKindNames())
+	webhookTemplateFlag    = flag.String("webhook-template", DefaultMessageTemplate, "Webhook message text/template")
+	webhookRetriesFlag     = flag.Int("webhook-retries", 3, "Number of times to retry failed webhooks")
+	onStartFlag            = flag.String("on-start", "", "Command to run when a deployment starts (optional)")
+	onSuccessFlag          = flag.String("on-success", "", "Command to run when a deployment succeeds (optional)")
+	onFailFlag             = flag.String("on-fail", "", "Command to run when a deployment fails (optional)")
+	onStopFlag             = flag.String("on-stop", "", "Command to run when a deployment is stopped (optional)")
+	onHookFailFlag         = flag.String("on-hook-fail", "", "Command to run when a lifecycle event fails on an instance (optional)")
+	onStuckFlag            = flag.String("on-stuck", "", "Command to run when an instance is flagged stuck (optional)")
+	onUnhealthyFlag        = flag.String("on-unhealthy", "", "Command to run when an instance succeeded but is unhealthy in a load balancer (optional)")
+	onAlarmFlag            = flag.String("on-alarm", "", "Command to run when an alarm that stops a deployment goes into ALARM (optional)")
+	hookTimeoutFlag        = flag.Duration("hook-timeout", time.Minute, "Kill commands run on state changes after this long")
+	hookConcurrencyFlag    = flag.Int("hook-concurrency", 4, "Maximum number of commands run on state changes at once")
+	bellFlag               = flag.Bool("bell", false, "Ring the terminal bell when a deployment finishes")
+	notifyFlag             = flag.String("notify", "", "Emit OSC 9 or 777 desktop notifications when a deployment finishes (optional)")
+	titleFlag              = flag.Bool("title", false, "Show deployment progress in the terminal title")
+	junitFlag              = flag.String("junit", "", "Write a JUnit XML report of the deployments to this file on exit (optional)")
+	stateFlag              = flag.Bool("state", false, "Save state to disk and resume watching from it on restart")
+	stateFileFlag          = flag.String("state-file", "", "Location of the state file (default in the user cache directory)")
+	eventsFlag             = flag.Int("events", 0, "Number of recent events to list below the deployments (default 10 when resuming state)")
+	deploymentIntervalFlag = flag.Duration("deployment-interval", 5*time.Second, "How often to list and refresh deployments")
+	instanceIntervalFlag   = flag.Duration("instance-interval", time.Second, "How often to update the instance list and redraw")
+	summaryIntervalFlag    = flag.Duration("summary-interval", 10*time.Second, "How often to fetch instance summaries, halved while instances are in progress and up to 4x while waiting")
+	jitterFlag             = flag.Float64("jitter", 0.1, "Randomly vary polling intervals by up to this fraction")
+	asgFlag                = flag.Bool("asg", true, "Show auto scaling group capacity and why instances were launched or terminated")
+	agentLogsFlag          = flag.String("agent-logs", "", "Applications csv to fetch codedeploy-agent logs from failed instances of with SSM Run Command (optional)")
+	agentLogLinesFlag      = flag.Int("agent-log-lines", 100, "Number of lines of each agent log to fetch")
+	agentLogDirFlag        = flag.String("agent-log-dir", "", "Directory to write fetched agent logs to (optional)")
+	agentConcurrencyFlag   = flag.Int("agent-log-concurrency", 4, "Maximum number of agent logs fetched at once")
+	sqsQueueFlag           = flag.String("sqs-queue", "", "Url of an SQS queue of CodeDeploy notifications to apply as they arrive, polling only to reconcile (optional)")
+	sqsEndpointFlag        = flag.String("sqs-endpoint", "", "Endpoint of a local SQS-compatible queue to use instead of SQS (optional)")
+	reconcileIntervalFlag  = flag.Duration("reconcile-interval", time.Minute, "How often to poll deployments and instance summaries when consuming an SQS queue")
+	targetGroupsFlag       = flag.String("target-groups", "", "Target group names or arns csv to show instance health in (optional)")
+	versionFlag            = flag.Bool("version", false, "Print version information and exit")
 )
 
+var (
+	webhookFlag      stringsFlag
+	slackWebhookFlag stringsFlag
+	logsFlag         stringsFlag
+)
+
+func init() {
+	flag.Var(&webhookFlag, "webhook", "Url to POST json transition events to (repeatable)")
+	flag.Var(&slackWebhookFlag, "slack-webhook", "Slack incoming webhook url to POST transition messages to (repeatable)")
+	flag.Var(&logsFlag, "logs", "CloudWatch Logs source of an application's instances as [APPLICATION=]LOG_GROUP[:STREAM_PATTERN] (repeatable)")
+}
+
+func transitionKindNames() string {
+	names := []string{}
+	for _, kind := range watch.TransitionKinds {
+		names = append(names, string(kind))
+	}
+	return strings.Join(names, ", ")
+}
+
 func versionInfo() string {
 	return fmt.Sprintf("%s %s %s %s %s", path.Base(os.Args[0]), Version, BuildTime, BuildHash, GoVersion)
 }
 
+// subcommands, each parsing its own flags
+var commands = map[string]func([]string){
+	"daemon":   daemonMain,
+	"diff":     diffMain,
+	"history":  historyMain,
+	"pipeline": pipelineMain,
+	"plan":     planMain,
+	"report":   reportMain,
+	"serve":    serveMain,
+	"timeline": timelineMain,
+}
+
+// openLog opens the log file named by the log-file flag, exiting on failure
+func openLog() (*os.File, *log.Logger) {
+	logFile, err := os.OpenFile(*logFileFlag, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		fmt.Printf("error opening log file: %v", err)
+		os.Exit(1)
+	}
+
+	return logFile, log.New(logFile, "", log.LstdFlags|log.Lshortfile)
+}
+
+// checkFormat exits with the usage of fs unless format is one of formats
+func checkFormat(fs *flag.FlagSet, format string, formats ...string) {
+	for _, f := range formats {
+		if format == f {
+			return
+		}
+	}
+
+	last := len(formats) - 1
+	want := strings.Join(formats[:last], ", ") + " or " + formats[last]
+	fmt.Fprintf(os.Stderr, "error parsing flags: unknown format %q, want %s\n\n", format, want)
+	fs.Usage()
+	os.Exit(1)
+}
+
+// consoleFlags are the global cli flags that only affect the console view
+var consoleFlags = []string{"compact", "hide-success", "events", "logs", "timeline", "bell", "notify", "title", "version"}
+
+// copyFlags registers the global cli flags on the flag set of a
+// subcommand, except the named ones
+func copyFlags(fs *flag.FlagSet, exclude ...string) {
+	excluded := map[string]bool{}
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if !excluded[f.Name] {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+func commandNames() string {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s [OPTIONS] DEPLOY_ID [DEPLOY_ID]...\nOptions:\n", versionInfo(), os.Args[0])
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s [OPTIONS] DEPLOY_ID [DEPLOY_ID]...\n       λ %s COMMAND [OPTIONS]\nCommands: %s\nOptions:\n", versionInfo(), os.Args[0], os.Args[0], commandNames())
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -46,21 +179,56 @@ func main() {
 		os.Exit(0)
 	}
 
-	logFile, err := os.OpenFile(*logFileFlag, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	runConsole(flag.CommandLine, flag.Args(), nil)
+}
+
+// runConsole shows the given deployments in the terminal until
+// a key is pressed, configured by the cli flags parsed by fs. The follow
+// func, if any, may start more work on the watcher before it starts.
+func runConsole(fs *flag.FlagSet, deploymentIds []string, follow func(watch.Aws, *watch.Watcher, *log.Logger)) {
+	err := validateIntervalFlags()
 	if err != nil {
-		fmt.Printf("error opening log file: %v", err)
+		fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
 		os.Exit(1)
 	}
+
+	logFile, logger := openLog()
 	defer logFile.Close()
 
-	logger := log.New(logFile, "", log.LstdFlags|log.Lshortfile)
+	sources, err := logSourcesFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error configuring logs: %v\n", err)
+		os.Exit(1)
+	}
+
+	aws := watch.NewAwsEnv()
+	watcher := newWatcherFromFlags(aws, logger, deploymentIds)
+	renderer := watcher.Renderer
+
+	err = registerWebhooks(renderer, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error configuring webhooks: %v\n", err)
+		os.Exit(1)
+	}
+	registerExecHooks(renderer, logger)
+	registerAgentLogs(aws, renderer, logger)
+
+	// write escape sequences to the same terminal as termui
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		tty = os.Stdout
+	} else {
+		defer tty.Close()
+	}
 
-	aws := NewAwsEnv()
-	renderer := NewRenderer(*compactFlag, *hideSuccessFlag)
-	checker := NewChecker(logger)
+	notifier, err := NewNotifier(tty, *bellFlag, *notifyFlag, *titleFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error configuring notifications: %v\n", err)
+		os.Exit(1)
+	}
+	renderer.OnTransition(notifier.Notify)
 
-	quitCh := make(chan bool)
-	renderCh := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
 
 	err = termui.Init()
 	if err != nil {
@@ -70,124 +238,188 @@ func main() {
 	defer termui.Close()
 
 	par := termui.NewPar("")
-	par.BorderLabel = "AWS CodeDeploy (press any key to quit)"
+	par.BorderLabel = "AWS CodeDeploy (t timeline, j/k select instance, l logs, any other key to quit)"
 	par.TextFgColor = termui.ColorWhite
 	par.BorderFg = termui.ColorGreen
 
-	termui.Body.AddRows(termui.NewRow(termui.NewCol(12, 0, par)))
+	logs := newLogPane(aws, renderer, sources)
 
-	termui.Body.Align()
-	termui.Render(par)
+	// lay out the log pane below the deployments while it is open
+	layout := func() {
+		termui.Body.Rows = []*termui.Row{termui.NewRow(termui.NewCol(12, 0, par))}
+		if logs.IsOpen() {
+			termui.Body.AddRows(termui.NewRow(termui.NewCol(12, 0, logs.Par)))
+		}
+		termui.Body.Align()
+		termui.Clear()
+		termui.Render(termui.Body)
+	}
+	layout()
 
-	termui.Handle(("/usr"), func(e termui.Event) {
-		trimContent := strings.TrimSpace(string(e.Data.([]byte)))
+	display := func(content []byte) {
+		trimContent := strings.TrimSpace(string(content))
 		par.Text = trimContent
 		par.Height = strings.Count(trimContent, "\n") + 3
 		termui.Body.Align()
-		termui.Render(par)
+		termui.Render(termui.Body)
+
+		if notifier.Title {
+			notifier.Update(renderer.Snapshot())
+		}
+	}
+
+	termui.Handle(("/usr"), func(e termui.Event) {
+		display(e.Data.([]byte))
 	})
 
 	termui.Handle("/sys/kbd", func(termui.Event) {
-		quitCh <- true
+		logger.Printf("Goodbye!")
+		cancel()
+		termui.StopLoop()
 	})
 
-	// periodically check for updated deployment information
-	// Created | Queued | InProgress | Succeeded | Failed | Stopped | Ready
-	includeOnlyStatuses := []string{"Created", "Queued", "InProgress"}
-
-	checkDeploymentIds := NewSet()
-	for _, deploymentId := range flag.Args() {
-		checkDeploymentIds.Add(deploymentId)
-	}
-
-	groups := strings.Split(*groupsFlag, ",")
-	checker.Check(5, func() {
-		for _, group := range groups {
-			if group != "" {
-				currentDeployments, err := aws.ListDeployments(*nameFlag, group, includeOnlyStatuses)
-				if err != nil {
-					logger.Printf("Error getting deployments: %s %s %s\n", *nameFlag, group, err)
-				} else {
-					for _, deploymentId := range currentDeployments {
-						checkDeploymentIds.Add(deploymentId)
-					}
-				}
-			}
-		}
+	// the timeline fills the paragraph, less its borders
+	renderer.SetWidth(termui.TermWidth() - 2)
+	if *timelineFlag {
+		renderer.ToggleTimeline()
+	}
+
+	termui.Handle("/sys/kbd/t", func(termui.Event) {
+		renderer.ToggleTimeline()
+		display(renderer.Bytes())
+	})
+
+	termui.Handle("/usr/logs", func(e termui.Event) {
+		logs.Par.Text = e.Data.(string)
+		termui.Render(termui.Body)
+	})
 
-		for _, deploymentId := range checkDeploymentIds.List() {
-			if !renderer.HasDeployment(deploymentId) {
-				logger.Printf("Starting to check deployment %s\n", deploymentId)
-			}
-			err := renderer.AddDeployment(aws, deploymentId)
-			if err != nil {
-				logger.Printf("Error getting deployment information: %s\n", err)
-			}
+	selectInstance := func(delta int) func(termui.Event) {
+		return func(termui.Event) {
+			renderer.Select(delta)
+			display(renderer.Bytes())
+			logs.Follow()
 		}
+	}
+	termui.Handle("/sys/kbd/j", selectInstance(1))
+	termui.Handle("/sys/kbd/<down>", selectInstance(1))
+	termui.Handle("/sys/kbd/k", selectInstance(-1))
+	termui.Handle("/sys/kbd/<up>", selectInstance(-1))
+
+	termui.Handle("/sys/kbd/l", func(termui.Event) {
+		logs.Toggle()
+		layout()
+	})
+
+	termui.Handle("/sys/wnd/resize", func(e termui.Event) {
+		renderer.SetWidth(e.Data.(termui.EvtWnd).Width - 2)
+		termui.Body.Width = termui.TermWidth()
+		termui.Body.Align()
+		termui.Clear()
+		termui.Render(termui.Body)
 	})
 
-	checkInstances := map[string]*Set{}
-	doneInstances := NewSet()
-
-	// periodically update list of instances to check
-	checker.Check(1, func() {
-		for _, deploymentId := range renderer.DeploymentIds() {
-			if _, ok := checkInstances[deploymentId]; !ok {
-				checkInstances[deploymentId] = NewSet()
-			}
-
-			for _, instanceId := range renderer.InstanceIds(deploymentId) {
-				if !checkInstances[deploymentId].Has(instanceId) {
-					logger.Printf("Starting to check instance %s (%s)\n", instanceId, deploymentId)
-					checkInstances[deploymentId].Add(instanceId)
-				}
-
-				if renderer.IsInstanceDone(instanceId) && !doneInstances.Has(instanceId) {
-					logger.Printf("Done checking instance %s (%s)\n", instanceId, deploymentId)
-					doneInstances.Add(instanceId)
-				}
-			}
+	store := resumeState(fs, watcher, logger)
+	logEvents(watcher, logger)
+
+	// redraw whenever the rendered content changes
+	current := []byte{}
+	watcher.Checker.Listen(watcher.Subscribe(16), func(watch.Event) {
+		content := renderer.Bytes()
+		if !bytes.Equal(content, current) {
+			current = content
+			termui.SendCustomEvt("/usr/t", content)
 		}
 	})
 
-	t := NewThrottle(5.0, 0.025)
+	watcher.Checker.Check(2, logs.Poll)
+
+	if follow != nil {
+		follow(aws, watcher, logger)
+	}
 
-	checker.Check(10, func() {
-		for deploymentId, instanceIds := range checkInstances {
-			batchCheckInstances := instanceIds.Dif(doneInstances).List()
+	watcher.Start(ctx)
 
-			if len(batchCheckInstances) == 0 {
-				continue
-			}
+	termui.Loop()
 
-			summaries, err := aws.BatchGetDeploymentInstances(deploymentId, batchCheckInstances)
-			if err != nil {
-				sleep := t.Throttle()
-				logger.Printf("Error getting deployment instance summaries %s: %s\n", deploymentId, err)
-				logger.Printf("Instance check throttle increased to %s\n", sleep)
-				time.Sleep(sleep)
-			} else {
-				// touch throttle for sleep decay
-				_ = t.Sleep()
-			}
+	if store != nil {
+		store.Checkpoint(renderer)
+	}
 
-			renderCh <- renderer.BatchUpdate(summaries)
+	if *junitFlag != "" {
+		err = writeJunitFile(*junitFlag, renderer)
+		if err != nil {
+			logger.Printf("Error writing junit report: %s\n", err)
 		}
-	})
+	}
+}
 
-	// start goroutine aggregating rendered content
-	checker.Updater(renderCh, func(content []byte) {
-		termui.SendCustomEvt("/usr/t", content)
-	})
+// validateIntervalFlags rejects polling intervals that are not positive,
+// and jitter that could make them so
+func validateIntervalFlags() error {
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"deployment-interval", *deploymentIntervalFlag},
+		{"instance-interval", *instanceIntervalFlag},
+		{"summary-interval", *summaryIntervalFlag},
+		{"reconcile-interval", *reconcileIntervalFlag},
+	} {
+		if interval.value <= 0 {
+			return fmt.Errorf("-%s must be positive, got %s", interval.name, interval.value)
+		}
+	}
 
-	// listen for quit signal
-	checker.Quiter(quitCh, func() {
-		logger.Printf("Goodbye!")
-		termui.StopLoop()
-	})
+	if *jitterFlag < 0 || *jitterFlag >= 1 {
+		return fmt.Errorf("-jitter must be at least 0 and less than 1, got %g", *jitterFlag)
+	}
 
-	termui.Loop()
+	return nil
+}
+
+// newWatcherFromFlags creates a watcher configured by the cli flags,
+// watching the given deployments
+func newWatcherFromFlags(aws watch.Aws, logger *log.Logger, deploymentIds []string) *watch.Watcher {
+	renderer := watch.NewRenderer(*compactFlag, *hideSuccessFlag, watch.NewStragglerDetector(*slowFactorFlag, *stuckAfterFlag))
+	renderer.SetEvents(*eventsFlag)
+
+	watcher := watch.NewWatcher(aws, renderer, logger, *nameFlag, strings.Split(*groupsFlag, ","), *historyFlag)
+	watcher.Poller.DeploymentInterval = *deploymentIntervalFlag
+	watcher.Poller.InstanceInterval = *instanceIntervalFlag
+	watcher.Poller.SummaryInterval = *summaryIntervalFlag
+	watcher.Poller.Jitter = *jitterFlag
+	watcher.Poller.AutoScaling = *asgFlag
+	if *targetGroupsFlag != "" {
+		watcher.Poller.TargetGroups = strings.Split(*targetGroupsFlag, ",")
+	}
+	watcher.Add(deploymentIds...)
 
-	close(quitCh)
-	close(renderCh)
+	if *sqsQueueFlag != "" {
+		watcher.Poller.DeploymentInterval = *reconcileIntervalFlag
+		watcher.Poller.SummaryInterval = *reconcileIntervalFlag
+		queue := watch.NewSqsQueue(*sqsQueueFlag, *sqsEndpointFlag)
+		watch.NewNotificationConsumer(queue, watcher.Poller, logger).Start(watcher.Checker)
+	}
+
+	return watcher
+}
+
+// logEvents writes every event but ticks to the log, along with how many
+// events slow subscribers missed. A batch of summaries of a large
+// deployment publishes several events per instance at once.
+func logEvents(watcher *watch.Watcher, logger *log.Logger) {
+	watcher.Checker.Listen(watcher.Subscribe(1024), func(e watch.Event) {
+		if _, ok := e.(*watch.Tick); !ok {
+			logger.Println(e)
+		}
+	})
+
+	var dropped int64
+	watcher.Checker.Check(5, func() {
+		if total := watcher.Renderer.Bus().Dropped(); total > dropped {
+			logger.Printf("Dropped %d events for subscribers with a full buffer\n", total-dropped)
+			dropped = total
+		}
+	})
 }
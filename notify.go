@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// Notifier alerts the user from the terminal when deployments finish,
+// by ringing the bell and emitting desktop notification escape sequences,
+// and keeps the terminal title up to date with deployment progress
+type Notifier struct {
+	Bell  bool
+	Osc   string
+	Title bool
+	out   io.Writer
+	title string
+	mu    sync.Mutex
+}
+
+// NewNotifier creates a notifier writing escape sequences to out. osc is
+// "9" or "777" to emit desktop notifications, empty for none.
+func NewNotifier(out io.Writer, bell bool, osc string, title bool) (*Notifier, error) {
+	if osc != "" && osc != "9" && osc != "777" {
+		return nil, fmt.Errorf("unknown notification escape sequence %q, must be 9 or 777", osc)
+	}
+
+	return &Notifier{
+		Bell:  bell,
+		Osc:   osc,
+		Title: title,
+		out:   out,
+	}, nil
+}
+
+// Notify alerts the user when a deployment finishes
+func (n *Notifier) Notify(t *watch.Transition) {
+	switch t.Kind {
+	case watch.DeploymentSucceeded, watch.DeploymentFailed, watch.DeploymentStopped:
+	default:
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Bell {
+		io.WriteString(n.out, "\a")
+	}
+
+	title := fmt.Sprintf("%s-%s %s", t.ApplicationName, t.DeploymentGroupName, t.Status)
+	body := t.DeploymentId
+	if t.Message != "" {
+		body += ": " + t.Message
+	}
+
+	switch n.Osc {
+	case "9":
+		fmt.Fprintf(n.out, "\x1b]9;%s\a", oscText(title+" "+body))
+	case "777":
+		fmt.Fprintf(n.out, "\x1b]777;notify;%s;%s\a", strings.Replace(oscText(title), ";", ",", -1), oscText(body))
+	}
+}
+
+// Update sets the terminal title to the progress of the deployments in snapshot
+func (n *Notifier) Update(snapshot *watch.Snapshot) {
+	if !n.Title {
+		return
+	}
+
+	title := TerminalTitle(snapshot)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if title == n.title {
+		return
+	}
+	n.title = title
+	fmt.Fprintf(n.out, "\x1b]0;%s\a", oscText(title))
+}
+
+// TerminalTitle summarizes the progress of each deployment, like
+// "web-prod 42/80 ✓ 1 ✗"
+func TerminalTitle(snapshot *watch.Snapshot) string {
+	parts := []string{}
+	for _, d := range snapshot.Deployments {
+		failed := 0
+		for _, i := range d.Instances {
+			if i.Status == "Failed" {
+				failed += 1
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s-%s %d/%d ✓ %d ✗", d.ApplicationName, d.DeploymentGroupName, d.Succeeded, d.Total, failed))
+	}
+
+	if len(parts) == 0 {
+		return "deploywatch"
+	}
+	return strings.Join(parts, " | ")
+}
+
+// oscText strips control characters, which would end the escape sequence early
+func oscText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func TestNotifierNotify(t *testing.T) {
+	for _, tt := range []struct {
+		bell bool
+		osc  string
+		kind watch.TransitionKind
+		out  string
+	}{
+		{true, "", watch.DeploymentSucceeded, "\a"},
+		{true, "", watch.DeploymentStarted, ""},
+		{false, "9", watch.DeploymentFailed, "\x1b]9;web-prod Failed d-1: boom \a"},
+		{false, "777", watch.DeploymentStopped, "\x1b]777;notify;web-prod Failed;d-1: boom \a"},
+		{false, "9", watch.LifecycleEventFailed, ""},
+	} {
+		var out bytes.Buffer
+		n, err := NewNotifier(&out, tt.bell, tt.osc, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n.Notify(&watch.Transition{
+			Kind:                tt.kind,
+			DeploymentId:        "d-1",
+			ApplicationName:     "web",
+			DeploymentGroupName: "prod",
+			Status:              "Failed",
+			Message:             "boom\n",
+		})
+
+		if out.String() != tt.out {
+			t.Errorf("NewNotifier(%t, %q).Notify(%s) => %q, want %q", tt.bell, tt.osc, tt.kind, out.String(), tt.out)
+		}
+	}
+
+	_, err := NewNotifier(&bytes.Buffer{}, false, "99", false)
+	if err == nil {
+		t.Errorf("NewNotifier() should reject unknown escape sequences")
+	}
+}
+
+func TestTerminalTitle(t *testing.T) {
+	snapshot := &watch.Snapshot{Deployments: []*watch.DeploymentSnapshot{
+		{
+			ApplicationName:     "web",
+			DeploymentGroupName: "prod",
+			Succeeded:           2,
+			Total:               4,
+			Instances: []*watch.InstanceSnapshot{
+				{Status: "Succeeded"},
+				{Status: "Succeeded"},
+				{Status: "Failed"},
+				{Status: "InProgress"},
+			},
+		},
+	}}
+
+	title := TerminalTitle(snapshot)
+	if title != "web-prod 2/4 ✓ 1 ✗" {
+		t.Errorf("TerminalTitle() => %q", title)
+	}
+
+	if TerminalTitle(&watch.Snapshot{}) != "deploywatch" {
+		t.Errorf("TerminalTitle() of no deployments => %q", TerminalTitle(&watch.Snapshot{}))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func pipelineMain(args []string) {
+	fs := flag.NewFlagSet("pipeline", flag.ExitOnError)
+	// along with every option of the console view
+	copyFlags(fs, "version")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s pipeline [OPTIONS] PIPELINE [EXECUTION_ID]\n", versionInfo(), os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nOnly the latest execution of each stage is known. Stages a newer execution\nhas run since show as superseded, without their actions or deployments.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	name, executionId := fs.Arg(0), fs.Arg(1)
+
+	runConsole(fs, nil, func(aws watch.Aws, watcher *watch.Watcher, logger *log.Logger) {
+		follower := watch.NewPipelineFollower(aws, watcher.Poller, logger, name, executionId)
+		follower.Interval = *deploymentIntervalFlag
+		follower.Start(watcher.Checker)
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func planMain(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	name := fs.String("name", "", "CodeDeploy application name")
+	group := fs.String("group", "", "CodeDeploy deployment group name")
+	config := fs.String("config", "", "CodeDeploy deployment config name (default the group's)")
+	since := fs.Duration("since", 7*24*time.Hour, "Estimate durations from deployments created within this duration")
+	limit := fs.Int("max", 20, "Maximum number of deployments to estimate durations from (0 for no limit)")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s plan [OPTIONS]\nOptions:\n", versionInfo(), os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *name == "" || *group == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	checkFormat(fs, *format, "table", "json")
+
+	p, err := watch.MakePlan(watch.NewAwsEnv(), *name, *group, *config, *since, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error planning deployment: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "json":
+		err = watch.WritePlanJson(os.Stdout, p)
+	default:
+		err = watch.WritePlanTable(os.Stdout, p)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing plan: %v\n", err)
+		os.Exit(1)
+	}
+}
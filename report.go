@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func reportMain(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "html", "Output format: html or markdown")
+	output := fs.String("o", "", "Output file (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s report [OPTIONS] DEPLOY_ID\nOptions:\n", versionInfo(), os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	checkFormat(fs, *format, "html", "markdown", "md")
+	deploymentId := fs.Arg(0)
+
+	aws := watch.NewAwsEnv()
+	renderer := watch.NewRenderer(false, false, nil)
+	err := renderer.LoadDeployment(aws, deploymentId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting deployment: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = renderer.AddDeploymentConfig(aws, deploymentId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting deployment config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var f *os.File
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		w = f
+	}
+
+	report := renderer.Report(deploymentId)
+	switch *format {
+	case "markdown", "md":
+		err = watch.WriteReportMarkdown(w, report)
+	default:
+		err = watch.WriteReportHtml(w, report)
+	}
+	if f != nil {
+		// os.Exit skips deferred calls, and a failed close may lose the output
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing report: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// Server publishes the renderer's state as a web dashboard, a json
+// api and a stream of server-sent events
+type Server struct {
+	renderer *watch.Renderer
+	metrics  *watch.Metrics
+	logger   *log.Logger
+	clients  map[chan []byte]bool
+	mu       sync.Mutex
+}
+
+func NewServer(renderer *watch.Renderer, metrics *watch.Metrics, logger *log.Logger) *Server {
+	return &Server{
+		renderer,
+		metrics,
+		logger,
+		map[chan []byte]bool{},
+		sync.Mutex{},
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/state", s.handleState)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics)
+	}
+	return mux
+}
+
+// Broadcast sends the current state to every connected event stream
+func (s *Server) Broadcast() {
+	snapshot := s.renderer.Snapshot()
+	if s.metrics != nil {
+		s.metrics.Update(snapshot)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		s.logger.Printf("Error encoding state: %s\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for client := range s.clients {
+		// drop updates for slow clients, the next one supersedes it anyway
+		select {
+		case client <- data:
+		default:
+		}
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardHtml)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(s.renderer.Snapshot())
+	if err != nil {
+		s.logger.Printf("Error encoding state: %s\n", err)
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	client := make(chan []byte, 1)
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(s.renderer.Snapshot())
+	if err == nil {
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case data := <-client:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func serveMain(args []string) {
+	runServer("serve", args, false)
+}
+
+// daemonMain is serve for long-lived use: it keeps discovering running
+// deployments and forgets finished ones after a while
+func daemonMain(args []string) {
+	runServer("daemon", args, true)
+}
+
+func runServer(command string, args []string, daemon bool) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "Address for the dashboard to listen on")
+	var retain *time.Duration
+	if daemon {
+		retain = fs.Duration("retain", time.Hour, "How long to keep finished deployments")
+	}
+	// along with the options of the console view that apply to the dashboard
+	copyFlags(fs, consoleFlags...)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s %s [OPTIONS] [DEPLOY_ID]...\nOptions:\n", versionInfo(), os.Args[0], command)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	err := validateIntervalFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	logFile, logger := openLog()
+	defer logFile.Close()
+
+	aws := watch.NewAwsEnv()
+	watcher := newWatcherFromFlags(aws, logger, fs.Args())
+	renderer := watcher.Renderer
+	if daemon {
+		watcher.Poller.Discover = true
+		watcher.Poller.Retain = *retain
+	}
+
+	err = registerWebhooks(renderer, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error configuring webhooks: %v\n", err)
+		os.Exit(1)
+	}
+	registerExecHooks(renderer, logger)
+	registerAgentLogs(aws, renderer, logger)
+
+	store := resumeState(fs, watcher, logger)
+
+	server := NewServer(renderer, watch.NewMetrics(renderer, watcher.Poller.Throttle()), logger)
+
+	// save what we know on the way out, like the console view does when it quits
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalCh
+		if store != nil {
+			store.Checkpoint(renderer)
+		}
+		if *junitFlag != "" {
+			err := writeJunitFile(*junitFlag, renderer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error writing junit report: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}()
+
+	logEvents(watcher, logger)
+
+	watcher.Checker.Listen(watcher.Subscribe(16), func(e watch.Event) {
+		// ticks only change elapsed times, which only matter while running
+		if _, ok := e.(*watch.Tick); ok {
+			if inProgress, _ := renderer.InstanceActivity(); inProgress == 0 {
+				return
+			}
+		}
+		server.Broadcast()
+	})
+
+	watcher.Start(context.Background())
+
+	logger.Printf("Serving dashboard on %s\n", *listen)
+	fmt.Fprintf(os.Stderr, "Serving dashboard on %s\n", *listen)
+
+	err = http.ListenAndServe(*listen, server.Handler())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error serving dashboard: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+const dashboardHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>deploywatch</title>
+<style>
+body { font-family: monospace; margin: 1em 2em; background: #fafafa; color: #222; }
+h2 { margin-bottom: 0.2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { padding: 2px 10px; text-align: left; vertical-align: top; }
+tr.instance { border-top: 1px solid #ddd; }
+.Pending, .Skipped { color: #b58900; }
+.InProgress, .Ready, .Created, .Queued { color: #268bd2; }
+.Succeeded { color: #2aa198; }
+.Failed, .Stopped, .stuck { color: #dc322f; font-weight: bold; }
+.slow { color: #cb4b16; }
+.events { color: #666; }
+#status { color: #999; }
+</style>
+</head>
+<body>
+<h1>AWS CodeDeploy</h1>
+<div id="status">connecting...</div>
+<div id="deployments"></div>
+<script>
+function esc(s) {
+  return String(s == null ? "" : s).replace(/[&<>"]/g, function(c) {
+    return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c];
+  });
+}
+function dur(s) {
+  return Math.floor(s / 60) + "m" + (s % 60) + "s";
+}
+function render(state) {
+  var html = "";
+  (state.deployments || []).forEach(function(d) {
+    html += "<h2>" + esc(d.deploymentId) + " " + esc(d.applicationName) + "-" + esc(d.deploymentGroupName) +
+      " <span class=\"" + esc(d.status) + "\">" + esc(d.status) + "</span> (" + d.succeeded + "/" + d.total + ")" +
+      (d.failureBudget != null ? " <span class=\"" + (d.failureBudget <= 1 ? "Failed" : "") + "\">failure budget " + d.failureBudget + "</span>" : "") +
+      (d.eta != null ? " eta " + dur(d.eta) : "") + "</h2>";
+    if (d.errorMessage) {
+      html += "<div class=\"Failed\">" + esc(d.errorMessage) + "</div>";
+    }
+    html += "<table><tr><th>instance</th><th>id</th><th>duration</th><th>status</th><th>lifecycle events</th></tr>";
+    d.instances.forEach(function(i) {
+      var flag = i.straggler ? " <span class=\"" + esc(i.straggler.lag) + "\">" + esc(i.straggler.lag) + " in " + esc(i.straggler.lifecycleEventName) + "</span>" : "";
+      var events = i.lifecycleEvents.map(function(e) {
+        return "<span class=\"" + esc(e.status) + "\">" + esc(e.name) + " " + dur(e.duration) + "</span>" +
+          (e.diagnostics && e.diagnostics.message ? " <span class=\"Failed\">" + esc(e.diagnostics.message) + "</span>" : "");
+      }).join("<br>");
+      html += "<tr class=\"instance\"><td>" + esc(i.name) + "</td><td>" + esc(i.instanceId) + "</td><td>" + dur(i.duration) +
+        "</td><td><span class=\"" + esc(i.status) + "\">" + esc(i.status) + "</span>" + flag +
+        (i.eta != null ? " eta " + dur(i.eta) : "") + "</td><td class=\"events\">" + events + "</td></tr>";
+    });
+    html += "</table>";
+  });
+  document.getElementById("deployments").innerHTML = html;
+  document.getElementById("status").textContent = "updated " + new Date(state.time).toLocaleTimeString();
+}
+var source = new EventSource("api/events");
+source.onmessage = function(e) { render(JSON.parse(e.data)); };
+source.onerror = function() { document.getElementById("status").textContent = "disconnected, retrying..."; };
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func testServerRenderer() *watch.Renderer {
+	renderer := watch.NewRenderer(false, false, nil)
+	renderer.Restore(&watch.State{
+		Deployments: []*codedeploy.DeploymentInfo{{
+			DeploymentId:        aws.String("d-1"),
+			ApplicationName:     aws.String("web"),
+			DeploymentGroupName: aws.String("prod"),
+			Status:              aws.String("InProgress"),
+		}},
+		DeploymentInstances: map[string][]string{"d-1": {"i-1"}},
+		Instances:           map[string]*ec2.Instance{"i-1": {InstanceId: aws.String("i-1")}},
+		InstanceSummaries: map[string]*codedeploy.InstanceSummary{"i-1": {
+			DeploymentId: aws.String("d-1"),
+			InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+			Status:       aws.String("InProgress"),
+		}},
+	})
+	return renderer
+}
+
+// readEvent reads the json state of the next server-sent event
+func readEvent(t *testing.T, r *bufio.Reader) *watch.Snapshot {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream => %s", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var snapshot watch.Snapshot
+		err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &snapshot)
+		if err != nil {
+			t.Fatalf("decoding event %q => %s", line, err)
+		}
+		return &snapshot
+	}
+}
+
+func TestServerState(t *testing.T) {
+	server := NewServer(watch.NewRenderer(false, false, nil), nil, log.New(ioutil.Discard, "", 0))
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var snapshot watch.Snapshot
+	err = json.NewDecoder(resp.Body).Decode(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.Deployments == nil || len(snapshot.Deployments) != 0 {
+		t.Errorf("GET /api/state => %+v, want no deployments", snapshot)
+	}
+
+	resp, err = http.Get(ts.URL + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /missing => %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServerStateDeployment(t *testing.T) {
+	server := NewServer(testServerRenderer(), nil, log.New(ioutil.Discard, "", 0))
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var snapshot watch.Snapshot
+	err = json.NewDecoder(resp.Body).Decode(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshot.Deployments) != 1 {
+		t.Fatalf("GET /api/state => %d deployments, want 1", len(snapshot.Deployments))
+	}
+	d := snapshot.Deployments[0]
+	if d.DeploymentId != "d-1" || d.ApplicationName != "web" || d.DeploymentGroupName != "prod" || d.Status != "InProgress" {
+		t.Errorf("GET /api/state deployment => %+v", d)
+	}
+	if len(d.Instances) != 1 || d.Instances[0].InstanceId != "i-1" || d.Instances[0].Status != "InProgress" {
+		t.Errorf("GET /api/state instances => %+v", d.Instances)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	renderer := testServerRenderer()
+	server := NewServer(renderer, nil, log.New(ioutil.Discard, "", 0))
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("GET /api/events content type => %s, want text/event-stream", contentType)
+	}
+
+	r := bufio.NewReader(resp.Body)
+
+	// the current state is sent as soon as the client connects
+	snapshot := readEvent(t, r)
+	if len(snapshot.Deployments) != 1 || snapshot.Deployments[0].Instances[0].Status != "InProgress" {
+		t.Fatalf("first event => %+v, want the current state", snapshot)
+	}
+
+	renderer.SetInstanceStatus("d-1", "i-1", "Succeeded")
+	server.Broadcast()
+
+	snapshot = readEvent(t, r)
+	if len(snapshot.Deployments) != 1 || snapshot.Deployments[0].Instances[0].Status != "Succeeded" {
+		t.Errorf("event after Broadcast() => %+v, want the updated state", snapshot)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// resumedEvents is how many recent events are listed after resuming from
+// saved state, unless -events is given
+const resumedEvents = 10
+
+// resumeState restores the watched deployments from the state file named
+// by the cli flags parsed by fs and keeps it saved, returning nil if state
+// is not kept
+func resumeState(fs *flag.FlagSet, watcher *watch.Watcher, logger *log.Logger) *watch.StateStore {
+	if !*stateFlag {
+		return nil
+	}
+
+	path := *stateFileFlag
+	if path == "" {
+		path = watch.DefaultStatePath(*nameFlag, strings.Split(*groupsFlag, ","), fs.Args())
+	}
+
+	store := watch.NewStateStore(path, logger)
+	deploymentIds := store.Resume(watcher.Renderer)
+	watcher.Add(deploymentIds...)
+	if len(deploymentIds) > 0 && !isFlagSet(fs, "events") {
+		watcher.Renderer.SetEvents(resumedEvents)
+	}
+	store.Watch(watcher.Checker, watcher.Renderer)
+
+	return store
+}
+
+// isFlagSet is true if the named flag was given to fs
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func timelineMain(args []string) {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	format := fs.String("format", "svg", "Output format: svg or html")
+	output := fs.String("o", "", "Output file (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: λ %s timeline [OPTIONS] DEPLOY_ID\nOptions:\n", versionInfo(), os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	checkFormat(fs, *format, "svg", "html")
+	deploymentId := fs.Arg(0)
+
+	renderer := watch.NewRenderer(false, false, nil)
+	err := renderer.LoadDeployment(watch.NewAwsEnv(), deploymentId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting deployment: %v\n", err)
+		os.Exit(1)
+	}
+
+	var f *os.File
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		w = f
+	}
+
+	t := renderer.Timeline(deploymentId)
+	switch *format {
+	case "html":
+		err = watch.WriteTimelineHtml(w, t)
+	default:
+		err = watch.WriteTimelineSvg(w, t)
+	}
+	if f != nil {
+		// os.Exit skips deferred calls, and a failed close may lose the output
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing timeline: %v\n", err)
+		os.Exit(1)
+	}
+}
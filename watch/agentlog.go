@@ -0,0 +1,193 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// agentLogPath is where the codedeploy-agent logs on linux instances
+const agentLogPath = "/var/log/aws/codedeploy-agent/codedeploy-agent.log"
+
+var (
+	deploymentIdRegexp = regexp.MustCompile(`^d-[A-Z0-9]+$`)
+	instanceIdRegexp   = regexp.MustCompile(`^i-[0-9a-f]+$`)
+)
+
+// AgentLog is the tail of the codedeploy-agent log and of a deployment's
+// scripts.log, fetched from an instance with SSM Run Command
+type AgentLog struct {
+	DeploymentId string    `json:"deploymentId"`
+	InstanceId   string    `json:"instanceId"`
+	Status       string    `json:"status"`
+	Output       string    `json:"output"`
+	Time         time.Time `json:"time"`
+}
+
+// AgentLogFetcher fetches the agent logs of instances whose lifecycle
+// events fail. Since this runs commands on the instances, it only does so
+// for the deployments of the applications it is given.
+type AgentLogFetcher struct {
+	// Lines is how many lines of each log are fetched
+	Lines int
+	// Dir, if set, is where fetched logs are written to, as
+	// DEPLOYMENT_ID-INSTANCE_ID.log
+	Dir string
+	// Timeout is how long to wait for a command to finish
+	Timeout time.Duration
+	// Interval is how often a running command is checked on
+	Interval time.Duration
+
+	aws          Aws
+	renderer     *Renderer
+	logger       *log.Logger
+	applications *Set
+	fetched      *Set
+	sem          chan bool
+}
+
+// NewAgentLogFetcher creates a fetcher for the named applications, running
+// at most concurrency commands at once
+func NewAgentLogFetcher(aws Aws, renderer *Renderer, logger *log.Logger, applications []string, concurrency int) *AgentLogFetcher {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	allowed := NewSet()
+	for _, application := range applications {
+		if application != "" {
+			allowed.Add(application)
+		}
+	}
+
+	return &AgentLogFetcher{
+		100,
+		"",
+		2 * time.Minute,
+		2 * time.Second,
+		aws,
+		renderer,
+		logger,
+		allowed,
+		NewSet(),
+		make(chan bool, concurrency),
+	}
+}
+
+// Notify fetches the agent logs of an instance in the background the first
+// time one of its lifecycle events fails in a deployment
+func (f *AgentLogFetcher) Notify(t *Transition) {
+	if t.Kind != LifecycleEventFailed || !f.applications.Has(t.ApplicationName) {
+		return
+	}
+
+	key := t.DeploymentId + "/" + t.InstanceId
+	if f.fetched.Has(key) {
+		return
+	}
+	f.fetched.Add(key)
+
+	go func() {
+		_, err := f.Fetch(t.DeploymentId, t.InstanceId)
+		if err != nil {
+			f.logger.Printf("Error fetching agent log: %s %s %s\n", t.DeploymentId, t.InstanceId, err)
+		}
+	}()
+}
+
+// Fetch runs a command tailing the agent logs on an instance and waits
+// for its output, which is added to the renderer and written to Dir. It
+// waits for a free slot if too many commands are already running.
+func (f *AgentLogFetcher) Fetch(deploymentId, instanceId string) (*AgentLog, error) {
+	// both ids end up in a shell command
+	if !deploymentIdRegexp.MatchString(deploymentId) || !instanceIdRegexp.MatchString(instanceId) {
+		return nil, fmt.Errorf("invalid deployment or instance id: %s %s", deploymentId, instanceId)
+	}
+
+	f.sem <- true
+	defer func() { <-f.sem }()
+
+	f.logger.Printf("Fetching agent log %s %s\n", deploymentId, instanceId)
+	commandId, err := f.aws.SendCommand(instanceId, agentLogCommands(deploymentId, f.Lines), "deploywatch agent log "+deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	status, output, err := f.wait(commandId, instanceId)
+	if err != nil {
+		return nil, err
+	}
+
+	agentLog := &AgentLog{deploymentId, instanceId, status, output, time.Now()}
+	f.renderer.AddAgentLog(agentLog)
+
+	if f.Dir != "" {
+		path := filepath.Join(f.Dir, fmt.Sprintf("%s-%s.log", deploymentId, instanceId))
+		err = os.MkdirAll(f.Dir, 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(output), 0644)
+		}
+		if err != nil {
+			return agentLog, err
+		}
+	}
+
+	return agentLog, nil
+}
+
+// wait polls a command until it finishes or times out
+func (f *AgentLogFetcher) wait(commandId, instanceId string) (string, string, error) {
+	deadline := time.Now().Add(f.Timeout)
+
+	for {
+		// the invocation may not exist until shortly after the command is sent
+		status, output, err := f.aws.GetCommandInvocation(commandId, instanceId)
+		if err == nil && isCommandDone(status) {
+			return status, output, nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return "", "", err
+			}
+			return "", "", errors.New("timed out waiting for command " + commandId)
+		}
+		time.Sleep(f.Interval)
+	}
+}
+
+func isCommandDone(status string) bool {
+	switch status {
+	case "Success", "Failed", "TimedOut", "Cancelled":
+		return true
+	default:
+		return false
+	}
+}
+
+// agentLogCommands tails the agent log and the scripts.log of a deployment,
+// which the agent keeps under the id of the deployment group
+func agentLogCommands(deploymentId string, lines int) []string {
+	return []string{
+		fmt.Sprintf("echo '==> %s <=='", agentLogPath),
+		fmt.Sprintf("tail -n %d %s", lines, agentLogPath),
+		fmt.Sprintf("for f in /opt/codedeploy-agent/deployment-root/*/%s/logs/scripts.log; do", deploymentId),
+		"  [ -f \"$f\" ] || continue",
+		"  echo \"==> $f <==\"",
+		fmt.Sprintf("  tail -n %d \"$f\"", lines),
+		"done",
+	}
+}
+
+// AgentLogStr marks instances whose agent log was fetched
+func AgentLogStr(agentLog *AgentLog) string {
+	if agentLog == nil {
+		return ""
+	}
+	return " " + StrColor("agent log", "cyan")
+}
@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSsmAws runs commands that finish on the second invocation check
+type fakeSsmAws struct {
+	fakeAws
+	commands []string
+	checks   int
+}
+
+func (f *fakeSsmAws) SendCommand(instanceId string, commands []string, comment string) (string, error) {
+	f.commands = commands
+	return "c-1", nil
+}
+
+func (f *fakeSsmAws) GetCommandInvocation(commandId, instanceId string) (string, string, error) {
+	f.checks += 1
+	if f.checks == 1 {
+		return "", "", errors.New("InvocationDoesNotExist")
+	}
+	return "Success", "agent output\n", nil
+}
+
+func TestAgentLogFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploywatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := &fakeSsmAws{}
+	renderer := NewRenderer(false, false, nil)
+	fetcher := NewAgentLogFetcher(fake, renderer, log.New(ioutil.Discard, "", 0), []string{"web"}, 1)
+	fetcher.Lines = 50
+	fetcher.Dir = dir
+	fetcher.Timeout = 10 * time.Second
+	fetcher.Interval = 5 * time.Millisecond
+
+	agentLog, err := fetcher.Fetch("d-ABC123", "i-0a1b")
+	if err != nil || agentLog.Status != "Success" {
+		t.Fatalf("Fetch() => %+v, %v", agentLog, err)
+	}
+	if !strings.Contains(strings.Join(fake.commands, "\n"), "deployment-root/*/d-ABC123/logs/scripts.log") {
+		t.Errorf("commands => %v", fake.commands)
+	}
+	if renderer.AgentLog("i-0a1b") != agentLog {
+		t.Errorf("AgentLog() => %+v", renderer.AgentLog("i-0a1b"))
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "d-ABC123-i-0a1b.log"))
+	if err != nil || string(b) != "agent output\n" {
+		t.Errorf("agent log file => %q, %v", b, err)
+	}
+
+	_, err = fetcher.Fetch("d-1; rm -rf /", "i-0a1b")
+	if err == nil {
+		t.Errorf("Fetch() with an invalid deployment id => no error")
+	}
+}
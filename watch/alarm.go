@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// AlarmState is the state of a CloudWatch alarm that stops the
+// deployments of a deployment group when it goes into ALARM
+type AlarmState struct {
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	Reason  string    `json:"reason,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Alarming is true while the alarm is in ALARM
+func (a *AlarmState) Alarming() bool {
+	return a.State == "ALARM"
+}
+
+// alarmNames lists the alarms that stop the deployments of a deployment
+// group, none if the group's alarm configuration is disabled
+func alarmNames(group *codedeploy.DeploymentGroupInfo) []string {
+	names := []string{}
+	config := group.AlarmConfiguration
+	if config == nil || !aws.BoolValue(config.Enabled) {
+		return names
+	}
+	for _, alarm := range config.Alarms {
+		names = append(names, aws.StringValue(alarm.Name))
+	}
+	return names
+}
+
+// NewAlarmStates converts alarms to their states, in the order of names.
+// Alarms that do not exist are reported in an unknown state.
+func NewAlarmStates(names []string, alarms []*cloudwatch.MetricAlarm) []*AlarmState {
+	byName := map[string]*cloudwatch.MetricAlarm{}
+	for _, alarm := range alarms {
+		byName[aws.StringValue(alarm.AlarmName)] = alarm
+	}
+
+	states := []*AlarmState{}
+	for _, name := range names {
+		alarm, ok := byName[name]
+		if !ok {
+			states = append(states, &AlarmState{Name: name, State: "UNKNOWN", Reason: "alarm not found"})
+			continue
+		}
+
+		states = append(states, &AlarmState{
+			Name:    name,
+			State:   aws.StringValue(alarm.StateValue),
+			Reason:  aws.StringValue(alarm.StateReason),
+			Updated: aws.TimeValue(alarm.StateUpdatedTimestamp),
+		})
+	}
+	return states
+}
+
+// stoppedByAlarm is true when CodeDeploy stopped a deployment because
+// one of its group's alarms was in ALARM
+func stoppedByAlarm(deployment *codedeploy.DeploymentInfo) bool {
+	return deployment.ErrorInformation != nil && aws.StringValue(deployment.ErrorInformation.Code) == codedeploy.ErrorCodeAlarmActive
+}
+
+// alarmingNames joins the names of the alarms in ALARM
+func alarmingNames(alarms []*AlarmState) string {
+	names := []string{}
+	for _, alarm := range alarms {
+		if alarm.Alarming() {
+			names = append(names, alarm.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// explainAlarmStop prefixes the message of a transition that finished a
+// deployment stopped by an alarm with the alarms that were in ALARM
+func explainAlarmStop(t *Transition, deployment *codedeploy.DeploymentInfo, alarms []*AlarmState) *Transition {
+	if t == nil || !stoppedByAlarm(deployment) {
+		return t
+	}
+
+	cause := "stopped by an alarm"
+	if names := alarmingNames(alarms); names != "" {
+		cause = "stopped by alarm " + names
+	}
+	if t.Message == "" {
+		t.Message = cause
+	} else {
+		t.Message = cause + ": " + t.Message
+	}
+	return t
+}
+
+// AlarmsStr counts the alarms of a deployment in ALARM
+func AlarmsStr(alarms []*AlarmState) string {
+	if len(alarms) == 0 {
+		return ""
+	}
+
+	n := 0
+	for _, alarm := range alarms {
+		if alarm.Alarming() {
+			n += 1
+		}
+	}
+
+	color := "green"
+	if n > 0 {
+		color = "red"
+	}
+	return " " + StrColor(fmt.Sprintf("alarms %d/%d", n, len(alarms)), color)
+}
+
+// AlarmLines warns about each alarm in ALARM, which stops a running
+// deployment, or explains that an alarm stopped a finished one
+func AlarmLines(deployment *codedeploy.DeploymentInfo, alarms []*AlarmState) string {
+	if IsDeploymentDone(deployment) {
+		if !stoppedByAlarm(deployment) {
+			return ""
+		}
+
+		cause := "stopped by an alarm of the deployment group"
+		if names := alarmingNames(alarms); names != "" {
+			cause = "stopped by alarm " + names
+		}
+		return fmt.Sprintf("  %s\n", StrColor("!! "+cause, "red"))
+	}
+
+	lines := ""
+	for _, alarm := range alarms {
+		if alarm.Alarming() {
+			warning := fmt.Sprintf("!! alarm %s is in ALARM, CodeDeploy will stop this deployment", alarm.Name)
+			lines += fmt.Sprintf("  %s %s\n", StrColor(warning, "red"), alarm.Reason)
+		}
+	}
+	return lines
+}
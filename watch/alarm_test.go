@@ -0,0 +1,52 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestNewAlarmStates(t *testing.T) {
+	states := NewAlarmStates([]string{"cpu-high", "errors", "missing"}, []*cloudwatch.MetricAlarm{
+		{AlarmName: aws.String("errors"), StateValue: aws.String("OK")},
+		{AlarmName: aws.String("cpu-high"), StateValue: aws.String("ALARM"), StateReason: aws.String("Threshold Crossed")},
+	})
+
+	for i, want := range []string{"cpu-high ALARM", "errors OK", "missing UNKNOWN"} {
+		if got := states[i].Name + " " + states[i].State; got != want {
+			t.Errorf("NewAlarmStates()[%d] => %s, want %s", i, got, want)
+		}
+	}
+
+	if AlarmsStr(states) != " [alarms 1/3](fg-red)" {
+		t.Errorf("AlarmsStr() => %s", AlarmsStr(states))
+	}
+}
+
+func TestExplainAlarmStop(t *testing.T) {
+	alarms := []*AlarmState{{Name: "cpu-high", State: "ALARM"}, {Name: "errors", State: "OK"}}
+
+	for _, tt := range []struct {
+		code    string
+		message string
+	}{
+		{codedeploy.ErrorCodeAlarmActive, "stopped by alarm cpu-high: alarm fired"},
+		{codedeploy.ErrorCodeHealthConstraints, "alarm fired"},
+	} {
+		deployment := &codedeploy.DeploymentInfo{
+			DeploymentId: aws.String("d-1"),
+			Status:       aws.String("Stopped"),
+			ErrorInformation: &codedeploy.ErrorInformation{
+				Code:    aws.String(tt.code),
+				Message: aws.String("alarm fired"),
+			},
+		}
+
+		transition := explainAlarmStop(deploymentTransition(&codedeploy.DeploymentInfo{Status: aws.String("InProgress")}, deployment), deployment, alarms)
+		if transition.Message != tt.message {
+			t.Errorf("explainAlarmStop(%s) => %q, want %q", tt.code, transition.Message, tt.message)
+		}
+	}
+}
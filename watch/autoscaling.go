@@ -0,0 +1,170 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// ScalingCause is why an auto scaling group launched or terminated an instance
+type ScalingCause string
+
+const (
+	// ScaledOut instances were launched because desired capacity was raised
+	ScaledOut ScalingCause = "scale-out"
+	// Replaced instances were launched to replace instances that went away
+	Replaced ScalingCause = "replaced"
+	// ScaledIn instances were terminated because desired capacity was lowered
+	ScaledIn ScalingCause = "scale-in"
+	// Terminated instances were taken out of service, usually by a health check
+	Terminated ScalingCause = "terminated"
+)
+
+// AutoScaling is the state of the auto scaling groups targeted by a
+// deployment group, and what they did to instances during a deployment
+type AutoScaling struct {
+	Groups    []*ScalingGroup             `json:"groups"`
+	Instances map[string]*ScalingActivity `json:"instances"`
+}
+
+// ScalingGroup holds the capacity of an auto scaling group
+type ScalingGroup struct {
+	Name      string `json:"name"`
+	Desired   int    `json:"desired"`
+	InService int    `json:"inService"`
+}
+
+// ScalingActivity is the launch or termination of an instance
+type ScalingActivity struct {
+	InstanceId string       `json:"instanceId"`
+	Group      string       `json:"group"`
+	Cause      ScalingCause `json:"cause"`
+	Status     string       `json:"status"`
+	Time       time.Time    `json:"time"`
+}
+
+var scalingDescriptionRegexp = regexp.MustCompile(`^(Launching a new|Terminating) EC2 instance: (i-[0-9a-f]+)`)
+
+// NewAutoScaling summarizes auto scaling groups along with the instance
+// activities that started after since. Activities are expected newest
+// first, so the latest activity of each instance wins.
+func NewAutoScaling(groups []*autoscaling.Group, activities []*autoscaling.Activity, since time.Time) *AutoScaling {
+	a := &AutoScaling{
+		Groups:    []*ScalingGroup{},
+		Instances: map[string]*ScalingActivity{},
+	}
+
+	for _, group := range groups {
+		g := &ScalingGroup{
+			Name:    aws.StringValue(group.AutoScalingGroupName),
+			Desired: int(aws.Int64Value(group.DesiredCapacity)),
+		}
+		for _, instance := range group.Instances {
+			if aws.StringValue(instance.LifecycleState) == "InService" {
+				g.InService += 1
+			}
+		}
+		a.Groups = append(a.Groups, g)
+	}
+
+	for _, activity := range activities {
+		if activity.StartTime == nil || activity.StartTime.Before(since) {
+			continue
+		}
+
+		s := scalingActivity(activity)
+		if s == nil {
+			continue
+		}
+		if _, ok := a.Instances[s.InstanceId]; !ok {
+			a.Instances[s.InstanceId] = s
+		}
+	}
+
+	return a
+}
+
+// scalingActivity parses the instance launch or termination described
+// by an activity, nil if it is neither
+func scalingActivity(activity *autoscaling.Activity) *ScalingActivity {
+	m := scalingDescriptionRegexp.FindStringSubmatch(aws.StringValue(activity.Description))
+	if m == nil {
+		return nil
+	}
+
+	// scaling policies, scheduled actions and users all change the
+	// desired capacity, anything else fills in for lost instances
+	resized := strings.Contains(aws.StringValue(activity.Cause), "changing the desired capacity")
+
+	var cause ScalingCause
+	switch {
+	case m[1] == "Terminating" && resized:
+		cause = ScaledIn
+	case m[1] == "Terminating":
+		cause = Terminated
+	case resized:
+		cause = ScaledOut
+	default:
+		cause = Replaced
+	}
+
+	return &ScalingActivity{
+		InstanceId: m[2],
+		Group:      aws.StringValue(activity.AutoScalingGroupName),
+		Cause:      cause,
+		Status:     aws.StringValue(activity.StatusCode),
+		Time:       *activity.StartTime,
+	}
+}
+
+// scalingGroupNames lists the auto scaling groups targeted by a deployment group
+func scalingGroupNames(group *codedeploy.DeploymentGroupInfo) []string {
+	names := []string{}
+	for _, asg := range group.AutoScalingGroups {
+		names = append(names, aws.StringValue(asg.Name))
+	}
+	return names
+}
+
+// sortActivities orders the activities of several groups newest first
+func sortActivities(activities []*autoscaling.Activity) {
+	sort.SliceStable(activities, func(i, j int) bool {
+		return aws.TimeValue(activities[i].StartTime).After(aws.TimeValue(activities[j].StartTime))
+	})
+}
+
+// AutoScalingStr shows the capacity of each auto scaling group
+func AutoScalingStr(a *AutoScaling) string {
+	if a == nil {
+		return ""
+	}
+
+	str := ""
+	for _, g := range a.Groups {
+		color := "white"
+		if g.InService < g.Desired {
+			color = "yellow"
+		}
+		str += " " + StrColor(fmt.Sprintf("asg %s %d/%d in service", g.Name, g.InService, g.Desired), color)
+	}
+	return str
+}
+
+// ScalingStr shows why an auto scaling group launched or terminated an instance
+func ScalingStr(s *ScalingActivity) string {
+	if s == nil {
+		return ""
+	}
+
+	color := "cyan"
+	if s.Cause == Terminated || s.Cause == ScaledIn {
+		color = "yellow"
+	}
+	return " " + StrColor(string(s.Cause), color)
+}
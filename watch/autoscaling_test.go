@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+)
+
+func testActivity(description, cause string, start time.Time) *autoscaling.Activity {
+	return &autoscaling.Activity{
+		AutoScalingGroupName: aws.String("web-asg"),
+		Description:          aws.String(description),
+		Cause:                aws.String(cause),
+		StatusCode:           aws.String("Successful"),
+		StartTime:            aws.Time(start),
+	}
+}
+
+func TestNewAutoScaling(t *testing.T) {
+	now := time.Now()
+
+	groups := []*autoscaling.Group{
+		{
+			AutoScalingGroupName: aws.String("web-asg"),
+			DesiredCapacity:      aws.Int64(3),
+			Instances: []*autoscaling.Instance{
+				{InstanceId: aws.String("i-1"), LifecycleState: aws.String("InService")},
+				{InstanceId: aws.String("i-2"), LifecycleState: aws.String("InService")},
+				{InstanceId: aws.String("i-3"), LifecycleState: aws.String("Pending")},
+			},
+		},
+	}
+
+	resized := "At 2017-09-01T10:00:00Z a monitor alarm cpu-high in state ALARM triggered policy scale-up changing the desired capacity from 2 to 3."
+	unhealthy := "At 2017-09-01T10:00:00Z an instance was taken out of service in response to an EC2 health check indicating it has been terminated or stopped."
+	replacing := "At 2017-09-01T10:00:00Z an instance was started in response to a difference between desired and actual capacity, increasing the capacity from 1 to 2."
+
+	activities := []*autoscaling.Activity{
+		testActivity("Launching a new EC2 instance: i-3", resized, now.Add(-time.Minute)),
+		testActivity("Launching a new EC2 instance: i-2", replacing, now.Add(-2*time.Minute)),
+		testActivity("Terminating EC2 instance: i-0", unhealthy, now.Add(-3*time.Minute)),
+		testActivity("Terminating EC2 instance: i-4", resized, now.Add(-4*time.Minute)),
+		testActivity("Launching a new EC2 instance: i-4", resized, now.Add(-5*time.Minute)),
+		testActivity("Launching a new EC2 instance: i-5", resized, now.Add(-time.Hour)),
+		testActivity("Updating load balancers/target groups: Successful.", resized, now.Add(-time.Minute)),
+	}
+
+	a := NewAutoScaling(groups, activities, now.Add(-10*time.Minute))
+
+	if len(a.Groups) != 1 || a.Groups[0].Desired != 3 || a.Groups[0].InService != 2 {
+		t.Errorf("Groups => %+v", a.Groups[0])
+	}
+
+	for instanceId, cause := range map[string]ScalingCause{
+		"i-0": Terminated,
+		"i-2": Replaced,
+		"i-3": ScaledOut,
+		"i-4": ScaledIn,
+		"i-5": "",
+	} {
+		s := a.Instances[instanceId]
+		if cause == "" {
+			if s != nil {
+				t.Errorf("Instances[%s] => %s, want none", instanceId, s.Cause)
+			}
+			continue
+		}
+		if s == nil || s.Cause != cause {
+			t.Errorf("Instances[%s] => %+v, want %s", instanceId, s, cause)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package watch
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// Aws interface hides all the difficult-to-manage string pointers
+// that the api returns
+type Aws interface {
+	ListDeployments(string, string, []string) ([]string, error)
+	ListDeploymentsCreatedBetween(string, string, []string, time.Time, time.Time) ([]string, error)
+	GetDeployment(string) (*codedeploy.DeploymentInfo, error)
+	GetDeploymentConfig(string) (*codedeploy.DeploymentConfigInfo, error)
+	GetApplicationRevision(string, *codedeploy.RevisionLocation) (*codedeploy.GenericRevisionInfo, error)
+	ListDeploymentInstances(string) ([]string, error)
+	DescribeInstances([]string) ([]*ec2.Instance, error)
+	FilterInstances([]*ec2.Filter) ([]*ec2.Instance, error)
+	BatchGetDeploymentInstances(string, []string) ([]*codedeploy.InstanceSummary, error)
+	GetDeploymentGroup(string, string) (*codedeploy.DeploymentGroupInfo, error)
+	DescribeAutoScalingGroups([]string) ([]*autoscaling.Group, error)
+	DescribeScalingActivities(string) ([]*autoscaling.Activity, error)
+	DescribeInstanceHealth(string) ([]*elb.InstanceState, error)
+	DescribeTargetHealth(string) ([]*elbv2.TargetHealthDescription, error)
+	DescribeAlarms([]string) ([]*cloudwatch.MetricAlarm, error)
+	DescribeLogStreams(string, string) ([]string, error)
+	FilterLogEvents(string, []string, time.Time, time.Time, *string) ([]*cloudwatchlogs.FilteredLogEvent, *string, error)
+	SendCommand(string, []string, string) (string, error)
+	GetCommandInvocation(string, string) (string, string, error)
+	GetPipeline(string) (*codepipeline.PipelineDeclaration, error)
+	GetPipelineState(string) (*codepipeline.GetPipelineStateOutput, error)
+	GetPipelineExecution(string, string) (*codepipeline.PipelineExecution, error)
+	LatestPipelineExecution(string) (string, error)
+}
+
+type awsEnv struct {
+	sess   *session.Session
+	cdSvc  *codedeploy.CodeDeploy
+	ec2Svc *ec2.EC2
+	asSvc  *autoscaling.AutoScaling
+	elbSvc *elb.ELB
+	lbSvc  *elbv2.ELBV2
+	cwSvc  *cloudwatch.CloudWatch
+	cwlSvc *cloudwatchlogs.CloudWatchLogs
+	ssmSvc *ssm.SSM
+	cpSvc  *codepipeline.CodePipeline
+}
+
+func NewAwsEnv() Aws {
+	var a awsEnv = awsEnv{}
+
+	a.sess = newSession()
+	a.cdSvc = codedeploy.New(a.sess)
+	a.ec2Svc = ec2.New(a.sess)
+	a.asSvc = autoscaling.New(a.sess)
+	a.elbSvc = elb.New(a.sess)
+	a.lbSvc = elbv2.New(a.sess)
+	a.cwSvc = cloudwatch.New(a.sess)
+	a.cwlSvc = cloudwatchlogs.New(a.sess)
+	a.ssmSvc = ssm.New(a.sess)
+	a.cpSvc = codepipeline.New(a.sess)
+	return &a
+}
+
+// newSession creates a session configured by the environment and shared
+// config, recording every api call
+func newSession() *session.Session {
+	// https://github.com/aws/aws-sdk-go/issues/384
+	var opts session.Options = session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile != "" {
+		opts.Profile = profile
+	}
+
+	// Create a session to share configuration, and load external configuration.
+	sess := session.Must(session.NewSessionWithOptions(opts))
+	sess.Handlers.Complete.PushBack(apiCalls.Record)
+	return sess
+}
+
+func (a *awsEnv) ListDeployments(applicationName, deploymentGroupName string, includeOnlyStatuses []string) ([]string, error) {
+	return a.listDeployments(newListDeploymentsInput(applicationName, deploymentGroupName, includeOnlyStatuses))
+}
+
+func (a *awsEnv) ListDeploymentsCreatedBetween(applicationName, deploymentGroupName string, includeOnlyStatuses []string, start, end time.Time) ([]string, error) {
+	input := newListDeploymentsInput(applicationName, deploymentGroupName, includeOnlyStatuses)
+
+	timeRange := &codedeploy.TimeRange{}
+	if !start.IsZero() {
+		timeRange.SetStart(start)
+	}
+	if !end.IsZero() {
+		timeRange.SetEnd(end)
+	}
+	input.SetCreateTimeRange(timeRange)
+
+	return a.listDeployments(input)
+}
+
+func newListDeploymentsInput(applicationName, deploymentGroupName string, includeOnlyStatuses []string) *codedeploy.ListDeploymentsInput {
+	input := &codedeploy.ListDeploymentsInput{}
+	if applicationName != "" {
+		input.SetApplicationName(applicationName)
+	}
+	if deploymentGroupName != "" {
+		input.SetDeploymentGroupName(deploymentGroupName)
+	}
+	if len(includeOnlyStatuses) > 0 {
+		input.SetIncludeOnlyStatuses(aws.StringSlice(includeOnlyStatuses))
+	}
+	return input
+}
+
+func (a *awsEnv) listDeployments(input *codedeploy.ListDeploymentsInput) ([]string, error) {
+	var (
+		deployments []string
+		nextToken   *string
+	)
+
+	for {
+		if nextToken != nil {
+			input.NextToken = nextToken
+		}
+
+		resp, err := a.cdSvc.ListDeployments(input)
+		if err != nil {
+			return nil, err
+		}
+
+		nextToken = resp.NextToken
+
+		deployments = append(deployments, aws.StringValueSlice(resp.Deployments)...)
+
+		if nextToken == nil {
+			break
+		}
+	}
+
+	return deployments, nil
+}
+
+func (a *awsEnv) GetDeployment(deployId string) (*codedeploy.DeploymentInfo, error) {
+	input := &codedeploy.GetDeploymentInput{}
+	input.SetDeploymentId(deployId)
+	output, err := a.cdSvc.GetDeployment(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.DeploymentInfo, nil
+}
+
+func (a *awsEnv) GetDeploymentConfig(deploymentConfigName string) (*codedeploy.DeploymentConfigInfo, error) {
+	input := &codedeploy.GetDeploymentConfigInput{}
+	input.SetDeploymentConfigName(deploymentConfigName)
+	output, err := a.cdSvc.GetDeploymentConfig(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.DeploymentConfigInfo, nil
+}
+
+func (a *awsEnv) GetApplicationRevision(applicationName string, revision *codedeploy.RevisionLocation) (*codedeploy.GenericRevisionInfo, error) {
+	input := &codedeploy.GetApplicationRevisionInput{}
+	input.SetApplicationName(applicationName)
+	input.SetRevision(revision)
+	output, err := a.cdSvc.GetApplicationRevision(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.RevisionInfo, nil
+}
+
+func (a *awsEnv) ListDeploymentInstances(deployId string) ([]string, error) {
+	input := &codedeploy.ListDeploymentInstancesInput{}
+	input.SetDeploymentId(deployId)
+
+	var (
+		instanceList []string
+		nextToken    *string
+	)
+
+	for {
+		if nextToken != nil {
+			input.NextToken = nextToken
+		}
+
+		resp, err := a.cdSvc.ListDeploymentInstances(input)
+		if err != nil {
+			return nil, err
+		}
+
+		nextToken = resp.NextToken
+
+		instanceList = append(instanceList, aws.StringValueSlice(resp.InstancesList)...)
+
+		if nextToken == nil {
+			break
+		}
+	}
+
+	return instanceList, nil
+}
+
+func (a *awsEnv) DescribeInstances(instanceIds []string) ([]*ec2.Instance, error) {
+	var instances []*ec2.Instance
+
+	// We can only ask for a maximum of 200 instance descriptions at a time
+	partitionedInstanceIds := partition(instanceIds, 200)
+
+	for _, ids := range partitionedInstanceIds {
+		found, err := a.FilterInstances([]*ec2.Filter{
+			{
+				Name:   aws.String("instance-id"),
+				Values: aws.StringSlice(ids),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, found...)
+	}
+
+	return instances, nil
+}
+
+// FilterInstances describes the instances matching all filters
+func (a *awsEnv) FilterInstances(filters []*ec2.Filter) ([]*ec2.Instance, error) {
+	var (
+		instances []*ec2.Instance
+		nextToken *string
+	)
+
+	input := &ec2.DescribeInstancesInput{Filters: filters}
+
+	for {
+		if nextToken != nil {
+			input.NextToken = nextToken
+		}
+
+		resp, err := a.ec2Svc.DescribeInstances(input)
+		if err != nil {
+			return nil, err
+		}
+
+		nextToken = resp.NextToken
+
+		for _, res := range resp.Reservations {
+			instances = append(instances, res.Instances...)
+		}
+
+		if nextToken == nil {
+			break
+		} else {
+			// pause briefly between each iteration
+			// to avoid rate throttling
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return instances, nil
+}
+
+func (a *awsEnv) BatchGetDeploymentInstances(deployId string, instanceIds []string) ([]*codedeploy.InstanceSummary, error) {
+	var instanceSummaries []*codedeploy.InstanceSummary
+
+	// We can only ask for a maximum of 100 deployment instances at a time
+	partitionedInstanceIds := partition(instanceIds, 100)
+	n := len(partitionedInstanceIds) - 1
+
+	for i := 0; i < len(partitionedInstanceIds); i++ {
+		ids := partitionedInstanceIds[i]
+
+		input := &codedeploy.BatchGetDeploymentInstancesInput{}
+		input.SetDeploymentId(deployId)
+		input.SetInstanceIds(aws.StringSlice(ids))
+
+		output, err := a.cdSvc.BatchGetDeploymentInstances(input)
+		if err != nil {
+			return nil, err
+		}
+
+		errMsg := strings.TrimSpace(aws.StringValue(output.ErrorMessage))
+		if errMsg != "" {
+			err = errors.New(errMsg)
+			return nil, err
+		}
+
+		instanceSummaries = append(instanceSummaries, output.InstancesSummary...)
+
+		// pause briefly between each iteration
+		// to avoid rate throttling
+		if i < n {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return instanceSummaries, nil
+}
+
+func (a *awsEnv) GetDeploymentGroup(applicationName, deploymentGroupName string) (*codedeploy.DeploymentGroupInfo, error) {
+	input := &codedeploy.GetDeploymentGroupInput{}
+	input.SetApplicationName(applicationName)
+	input.SetDeploymentGroupName(deploymentGroupName)
+	output, err := a.cdSvc.GetDeploymentGroup(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.DeploymentGroupInfo, nil
+}
+
+func (a *awsEnv) DescribeAutoScalingGroups(names []string) ([]*autoscaling.Group, error) {
+	var groups []*autoscaling.Group
+
+	// We can only ask for a maximum of 50 auto scaling groups at a time
+	for _, ids := range partition(names, 50) {
+		input := &autoscaling.DescribeAutoScalingGroupsInput{}
+		input.SetAutoScalingGroupNames(aws.StringSlice(ids))
+
+		output, err := a.asSvc.DescribeAutoScalingGroups(input)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, output.AutoScalingGroups...)
+	}
+
+	return groups, nil
+}
+
+// DescribeScalingActivities returns the most recent activities of an
+// auto scaling group, newest first
+func (a *awsEnv) DescribeScalingActivities(name string) ([]*autoscaling.Activity, error) {
+	input := &autoscaling.DescribeScalingActivitiesInput{}
+	input.SetAutoScalingGroupName(name)
+	input.SetMaxRecords(50)
+
+	output, err := a.asSvc.DescribeScalingActivities(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Activities, nil
+}
+
+func (a *awsEnv) DescribeInstanceHealth(loadBalancerName string) ([]*elb.InstanceState, error) {
+	input := &elb.DescribeInstanceHealthInput{}
+	input.SetLoadBalancerName(loadBalancerName)
+
+	output, err := a.elbSvc.DescribeInstanceHealth(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.InstanceStates, nil
+}
+
+// DescribeTargetHealth returns the health of every target of a target
+// group, given by name or arn
+func (a *awsEnv) DescribeTargetHealth(targetGroup string) ([]*elbv2.TargetHealthDescription, error) {
+	targetGroupArn := targetGroup
+	if !strings.HasPrefix(targetGroup, "arn:") {
+		input := &elbv2.DescribeTargetGroupsInput{}
+		input.SetNames([]*string{aws.String(targetGroup)})
+
+		output, err := a.lbSvc.DescribeTargetGroups(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(output.TargetGroups) == 0 {
+			return nil, errors.New("target group not found: " + targetGroup)
+		}
+		targetGroupArn = aws.StringValue(output.TargetGroups[0].TargetGroupArn)
+	}
+
+	input := &elbv2.DescribeTargetHealthInput{}
+	input.SetTargetGroupArn(targetGroupArn)
+
+	output, err := a.lbSvc.DescribeTargetHealth(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.TargetHealthDescriptions, nil
+}
+
+func (a *awsEnv) DescribeAlarms(alarmNames []string) ([]*cloudwatch.MetricAlarm, error) {
+	var alarms []*cloudwatch.MetricAlarm
+
+	// We can only ask for a maximum of 100 alarms at a time
+	for _, names := range partition(alarmNames, 100) {
+		input := &cloudwatch.DescribeAlarmsInput{}
+		input.SetAlarmNames(aws.StringSlice(names))
+
+		output, err := a.cwSvc.DescribeAlarms(input)
+		if err != nil {
+			return nil, err
+		}
+
+		alarms = append(alarms, output.MetricAlarms...)
+	}
+
+	return alarms, nil
+}
+
+// DescribeLogStreams lists the names of the log streams of a log group
+// starting with prefix
+func (a *awsEnv) DescribeLogStreams(logGroupName, prefix string) ([]string, error) {
+	input := &cloudwatchlogs.DescribeLogStreamsInput{}
+	input.SetLogGroupName(logGroupName)
+	if prefix != "" {
+		input.SetLogStreamNamePrefix(prefix)
+	}
+
+	var (
+		streams   []string
+		nextToken *string
+	)
+
+	for {
+		if nextToken != nil {
+			input.NextToken = nextToken
+		}
+
+		resp, err := a.cwlSvc.DescribeLogStreams(input)
+		if err != nil {
+			return nil, err
+		}
+
+		nextToken = resp.NextToken
+
+		for _, stream := range resp.LogStreams {
+			streams = append(streams, aws.StringValue(stream.LogStreamName))
+		}
+
+		if nextToken == nil {
+			break
+		}
+	}
+
+	return streams, nil
+}
+
+// FilterLogEvents returns a page of the events of log streams between
+// start and end, a zero end for no end, along with the token of the next
+// page, nil on the last page
+func (a *awsEnv) FilterLogEvents(logGroupName string, streams []string, start, end time.Time, nextToken *string) ([]*cloudwatchlogs.FilteredLogEvent, *string, error) {
+	input := &cloudwatchlogs.FilterLogEventsInput{}
+	input.SetLogGroupName(logGroupName)
+	input.SetLogStreamNames(aws.StringSlice(streams))
+	input.SetInterleaved(true)
+	input.SetStartTime(aws.TimeUnixMilli(start))
+	if !end.IsZero() {
+		input.SetEndTime(aws.TimeUnixMilli(end))
+	}
+	input.NextToken = nextToken
+
+	output, err := a.cwlSvc.FilterLogEvents(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output.Events, output.NextToken, nil
+}
+
+// SendCommand runs shell commands on an instance with AWS-RunShellScript,
+// returning the command id
+func (a *awsEnv) SendCommand(instanceId string, commands []string, comment string) (string, error) {
+	input := &ssm.SendCommandInput{}
+	input.SetDocumentName("AWS-RunShellScript")
+	input.SetInstanceIds([]*string{aws.String(instanceId)})
+	input.SetParameters(map[string][]*string{"commands": aws.StringSlice(commands)})
+	input.SetComment(comment)
+
+	output, err := a.ssmSvc.SendCommand(input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.Command.CommandId), nil
+}
+
+// GetCommandInvocation returns the status and standard output of a
+// command sent to an instance
+func (a *awsEnv) GetCommandInvocation(commandId, instanceId string) (string, string, error) {
+	input := &ssm.GetCommandInvocationInput{}
+	input.SetCommandId(commandId)
+	input.SetInstanceId(instanceId)
+
+	output, err := a.ssmSvc.GetCommandInvocation(input)
+	if err != nil {
+		return "", "", err
+	}
+
+	return aws.StringValue(output.Status), aws.StringValue(output.StandardOutputContent), nil
+}
+
+func (a *awsEnv) GetPipeline(pipelineName string) (*codepipeline.PipelineDeclaration, error) {
+	input := &codepipeline.GetPipelineInput{}
+	input.SetName(pipelineName)
+	output, err := a.cpSvc.GetPipeline(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Pipeline, nil
+}
+
+func (a *awsEnv) GetPipelineState(pipelineName string) (*codepipeline.GetPipelineStateOutput, error) {
+	input := &codepipeline.GetPipelineStateInput{}
+	input.SetName(pipelineName)
+	return a.cpSvc.GetPipelineState(input)
+}
+
+func (a *awsEnv) GetPipelineExecution(pipelineName, executionId string) (*codepipeline.PipelineExecution, error) {
+	input := &codepipeline.GetPipelineExecutionInput{}
+	input.SetPipelineName(pipelineName)
+	input.SetPipelineExecutionId(executionId)
+	output, err := a.cpSvc.GetPipelineExecution(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.PipelineExecution, nil
+}
+
+// LatestPipelineExecution returns the id of the most recently started
+// execution of a pipeline
+func (a *awsEnv) LatestPipelineExecution(pipelineName string) (string, error) {
+	input := &codepipeline.ListPipelineExecutionsInput{}
+	input.SetPipelineName(pipelineName)
+	input.SetMaxResults(1)
+	output, err := a.cpSvc.ListPipelineExecutions(input)
+	if err != nil {
+		return "", err
+	}
+	if len(output.PipelineExecutionSummaries) == 0 {
+		return "", errors.New("no executions of pipeline " + pipelineName)
+	}
+
+	return aws.StringValue(output.PipelineExecutionSummaries[0].PipelineExecutionId), nil
+}
+
+// partition splits a slice of strings into multiple
+// sub-slices, each no longer than `size`
+func partition(data []string, size int) [][]string {
+	if size <= 0 {
+		return [][]string{}
+	}
+
+	// we will end up with n slices of length size or less
+	n := int(math.Ceil(float64(len(data)) / float64(size)))
+
+	if n <= 0 {
+		return [][]string{}
+	}
+
+	result := make([][]string, n)
+
+	for i := 0; i < n; i++ {
+		start := i * size
+		end := min(len(data), (i+1)*size)
+		subLen := end - start
+
+		subslice := make([]string, subLen)
+
+		for j := 0; j < subLen; j++ {
+			subslice[j] = data[start+j]
+		}
+
+		result[i] = subslice
+	}
+
+	return result
+}
+
+func min(x, y int) int {
+	return int(math.Min(float64(x), float64(y)))
+}
@@ -1,11 +1,14 @@
-package main
+package watch
 
 import (
-	"bytes"
 	"log"
 	"time"
 )
 
+// minScheduleInterval keeps scheduled functions from running in a busy
+// loop when their interval is zero or negative
+const minScheduleInterval = 10 * time.Millisecond
+
 type Checker struct {
 	quiters []chan bool
 	logger  *log.Logger
@@ -55,6 +58,32 @@ func (c *Checker) Check(seconds int, fn func()) {
 	c.quiters = append(c.quiters, q)
 }
 
+// Schedule is like Check, but waits for the interval returned by next
+// between calls, so the interval may change from one call to the next.
+// Intervals are at least minScheduleInterval.
+func (c *Checker) Schedule(next func() time.Duration, fn func()) {
+	q := make(chan bool)
+	go func() {
+		// call the function prior to the first interval
+		fn()
+		for {
+			interval := next()
+			if interval < minScheduleInterval {
+				interval = minScheduleInterval
+			}
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+				fn()
+			case <-q:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	c.quiters = append(c.quiters, q)
+}
+
 type CheckInstanceFunc func(string, string)
 
 func (c *Checker) CheckInstance(seconds int, deploymentId, instanceId string, fn CheckInstanceFunc) {
@@ -75,21 +104,23 @@ func (c *Checker) CheckInstance(seconds int, deploymentId, instanceId string, fn
 	c.quiters = append(c.quiters, q)
 }
 
-func (c *Checker) Updater(dataCh <-chan []byte, fn func([]byte)) {
+// Listen calls fn with every event received on events, until it is closed
+func (c *Checker) Listen(events <-chan Event, fn func(Event)) {
 	q := make(chan bool)
-	go func(dataCh <-chan []byte) {
-		currentData := make([]byte, 0)
+	go func() {
 		for {
 			select {
-			case data := <-dataCh:
-				if !bytes.Equal(data, currentData) {
-					currentData = data
-					fn(currentData)
+			case e, ok := <-events:
+				if !ok {
+					// wait for quit, which sends on q
+					<-q
+					return
 				}
+				fn(e)
 			case <-q:
 				return
 			}
 		}
-	}(dataCh)
+	}()
 	c.quiters = append(c.quiters, q)
 }
@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestCheckerScheduleMinimumInterval(t *testing.T) {
+	checker := NewChecker(log.New(ioutil.Discard, "", 0))
+	defer checker.Quit()
+
+	calls := make(chan time.Time, 10)
+	checker.Schedule(func() time.Duration {
+		return 0
+	}, func() {
+		select {
+		case calls <- time.Now():
+		default:
+		}
+	})
+
+	// a zero interval is clamped, rather than calling fn in a busy loop
+	var prev time.Time
+	for i := 0; i < 4; i++ {
+		select {
+		case call := <-calls:
+			if i > 0 && call.Sub(prev) < minScheduleInterval {
+				t.Errorf("Schedule() with a zero interval => call %d after %s, want at least %s", i, call.Sub(prev), minScheduleInterval)
+			}
+			prev = call
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Schedule() with a zero interval => %d calls in 5s, want 4", i)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package watch
+
+import (
+	"math"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// MinimumHealthyInstances is the number of instances out of total that
+// must stay healthy for a deployment using config to succeed
+func MinimumHealthyInstances(config *codedeploy.DeploymentConfigInfo, total int) int {
+	if config == nil || config.MinimumHealthyHosts == nil {
+		return 0
+	}
+
+	value := int(aws.Int64Value(config.MinimumHealthyHosts.Value))
+
+	var minHealthy int
+	switch aws.StringValue(config.MinimumHealthyHosts.Type) {
+	case "HOST_COUNT":
+		minHealthy = value
+	case "FLEET_PERCENT":
+		// CodeDeploy rounds the healthy host requirement up
+		minHealthy = int(math.Ceil(float64(total) * float64(value) / 100.0))
+	case "MOST_CONCURRENCY":
+		// CodeDeployDefault.OneAtATime
+		minHealthy = total - 1
+	}
+
+	if minHealthy < 0 {
+		return 0
+	}
+	if minHealthy > total {
+		return total
+	}
+
+	return minHealthy
+}
+
+// MaxConcurrentInstances is the number of instances CodeDeploy will
+// deploy to at the same time, ie. the size of each deployment wave
+func MaxConcurrentInstances(config *codedeploy.DeploymentConfigInfo, total int) int {
+	if config == nil || config.MinimumHealthyHosts == nil {
+		return 0
+	}
+
+	concurrent := total - MinimumHealthyInstances(config, total)
+
+	// CodeDeploy always makes progress on at least one instance
+	if concurrent < 1 {
+		return 1
+	}
+
+	return concurrent
+}
+
+// FailureBudget is how many more of total instances can fail before
+// CodeDeploy fails a deployment using config, given the instances that
+// failed already, along with how many could fail in all. It is not ok
+// without a config to go by.
+func FailureBudget(config *codedeploy.DeploymentConfigInfo, total, failed int) (int, int, bool) {
+	if config == nil || config.MinimumHealthyHosts == nil {
+		return 0, 0, false
+	}
+
+	allowed := total - MinimumHealthyInstances(config, total)
+
+	// CodeDeployDefault.OneAtATime stops at the first failure
+	if aws.StringValue(config.MinimumHealthyHosts.Type) == "MOST_CONCURRENCY" {
+		allowed = 0
+	}
+
+	// and no deployment succeeds without a single healthy instance
+	if allowed > total-1 {
+		allowed = total - 1
+	}
+	if allowed < 0 {
+		allowed = 0
+	}
+
+	budget := allowed - failed
+	if budget < 0 {
+		budget = 0
+	}
+
+	return budget, allowed, true
+}
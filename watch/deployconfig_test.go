@@ -0,0 +1,65 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func testDeploymentConfig(minType string, value int64) *codedeploy.DeploymentConfigInfo {
+	return &codedeploy.DeploymentConfigInfo{
+		MinimumHealthyHosts: &codedeploy.MinimumHealthyHosts{
+			Type:  aws.String(minType),
+			Value: aws.Int64(value),
+		},
+	}
+}
+
+func TestMaxConcurrentInstances(t *testing.T) {
+	for _, tt := range []struct {
+		config *codedeploy.DeploymentConfigInfo
+		total  int
+		r      int
+	}{
+		{nil, 10, 0},
+		{testDeploymentConfig("HOST_COUNT", 6), 9, 3},
+		{testDeploymentConfig("HOST_COUNT", 0), 9, 9},
+		{testDeploymentConfig("HOST_COUNT", 12), 9, 1},
+		{testDeploymentConfig("FLEET_PERCENT", 40), 9, 5},
+		{testDeploymentConfig("FLEET_PERCENT", 50), 10, 5},
+		{testDeploymentConfig("MOST_CONCURRENCY", 1), 10, 1},
+	} {
+		r := MaxConcurrentInstances(tt.config, tt.total)
+		if r != tt.r {
+			t.Errorf("MaxConcurrentInstances(%v, %d) => %d, want %d", tt.config, tt.total, r, tt.r)
+		}
+	}
+}
+
+func TestFailureBudget(t *testing.T) {
+	for _, tt := range []struct {
+		config  *codedeploy.DeploymentConfigInfo
+		total   int
+		failed  int
+		budget  int
+		allowed int
+		str     string
+	}{
+		{nil, 10, 0, 0, 0, ""},
+		{testDeploymentConfig("FLEET_PERCENT", 50), 10, 0, 5, 5, " [failure budget 5/5](fg-green)"},
+		{testDeploymentConfig("FLEET_PERCENT", 50), 10, 3, 2, 5, " [failure budget 2/5](fg-yellow)"},
+		{testDeploymentConfig("FLEET_PERCENT", 50), 10, 4, 1, 5, " [failure budget 1/5](fg-red)"},
+		{testDeploymentConfig("FLEET_PERCENT", 50), 10, 7, 0, 5, " [failure budget 0/5](fg-red)"},
+		{testDeploymentConfig("HOST_COUNT", 0), 4, 0, 3, 3, " [failure budget 3/3](fg-green)"},
+		{testDeploymentConfig("MOST_CONCURRENCY", 1), 10, 0, 0, 0, " [failure budget 0/0](fg-red)"},
+	} {
+		budget, allowed, ok := FailureBudget(tt.config, tt.total, tt.failed)
+		if budget != tt.budget || allowed != tt.allowed || ok != (tt.config != nil) {
+			t.Errorf("FailureBudget(%v, %d, %d) => %d, %d, %t, want %d, %d", tt.config, tt.total, tt.failed, budget, allowed, ok, tt.budget, tt.allowed)
+		}
+		if str := FailureBudgetStr(budget, allowed, ok); str != tt.str {
+			t.Errorf("FailureBudgetStr(%d, %d, %t) => %q, want %q", budget, allowed, ok, str, tt.str)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package watch
+
+import (
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// EtaEstimator predicts how much longer instances in a deployment will
+// take, preferring durations from completed instances of the same
+// deployment and falling back to historical durations for the group
+type EtaEstimator struct {
+	peers   *DurationSamples
+	history *GroupHistory
+}
+
+func NewEtaEstimator(summaries []*codedeploy.InstanceSummary, history *GroupHistory) *EtaEstimator {
+	peers := NewDurationSamples()
+	for _, summary := range summaries {
+		peers.Add(summary)
+	}
+
+	return &EtaEstimator{peers, history}
+}
+
+// ExpectedEvent is the expected duration in seconds of the named lifecycle event
+func (e *EtaEstimator) ExpectedEvent(name string) (int, bool) {
+	if durations := e.peers.events[name]; len(durations) > 0 {
+		return NewDurationStats(name, durations).P50, true
+	}
+
+	if stats := e.history.Event(name); stats != nil && stats.Count > 0 {
+		return stats.P50, true
+	}
+
+	return 0, false
+}
+
+// ExpectedInstance is the expected duration in seconds of a whole instance
+func (e *EtaEstimator) ExpectedInstance() (int, bool) {
+	if len(e.peers.instance) > 0 {
+		return NewDurationStats("Instance", e.peers.instance).P50, true
+	}
+
+	if e.history != nil && e.history.Instance != nil && e.history.Instance.Count > 0 {
+		return e.history.Instance.P50, true
+	}
+
+	return 0, false
+}
+
+// Instance is the expected remaining time in seconds for an
+// instance that has not finished yet
+func (e *EtaEstimator) Instance(summary *codedeploy.InstanceSummary) (int, bool) {
+	if summary == nil {
+		return e.ExpectedInstance()
+	}
+
+	switch *summary.Status {
+	case "Pending", "InProgress":
+	default:
+		return 0, false
+	}
+
+	if len(summary.LifecycleEvents) == 0 {
+		return e.ExpectedInstance()
+	}
+
+	remaining := 0
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		status := *lifecycleEvent.Status
+		if status != "Pending" && status != "InProgress" {
+			continue
+		}
+
+		expected, ok := e.ExpectedEvent(*lifecycleEvent.LifecycleEventName)
+		if !ok {
+			return 0, false
+		}
+
+		if status == "InProgress" {
+			expected -= LifecycleEventDuration(lifecycleEvent)
+			if expected < 0 {
+				expected = 0
+			}
+		}
+
+		remaining += expected
+	}
+
+	return remaining, true
+}
+
+// Deployment is the expected remaining time in seconds for a deployment.
+// Instances without a summary are treated as pending. Pending instances
+// are deployed in waves of maxConcurrent instances once the instances
+// currently in progress are done.
+func (e *EtaEstimator) Deployment(summaries []*codedeploy.InstanceSummary, maxConcurrent int) (int, bool) {
+	if maxConcurrent < 1 {
+		return 0, false
+	}
+
+	var (
+		active     = 0
+		inProgress = 0
+		pending    = 0
+	)
+
+	for _, summary := range summaries {
+		status := "Pending"
+		if summary != nil {
+			status = *summary.Status
+		}
+
+		switch status {
+		case "Pending":
+			pending += 1
+		case "InProgress":
+			active += 1
+			remaining, ok := e.Instance(summary)
+			if !ok {
+				return 0, false
+			}
+			if remaining > inProgress {
+				inProgress = remaining
+			}
+		}
+	}
+
+	if pending == 0 {
+		return inProgress, active > 0
+	}
+
+	expected, ok := e.ExpectedInstance()
+	if !ok {
+		return 0, false
+	}
+
+	waves := (pending + maxConcurrent - 1) / maxConcurrent
+
+	return inProgress + waves*expected, true
+}
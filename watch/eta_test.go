@@ -0,0 +1,52 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestEtaEstimatorDeployment(t *testing.T) {
+	now := time.Now()
+
+	done := &codedeploy.InstanceSummary{
+		Status: aws.String("Succeeded"),
+		LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("Install", "Succeeded", now, 60),
+			testLifecycleEvent("ValidateService", "Succeeded", now, 30),
+		},
+	}
+	pending := &codedeploy.InstanceSummary{
+		Status: aws.String("Pending"),
+		LifecycleEvents: []*codedeploy.LifecycleEvent{
+			{LifecycleEventName: aws.String("Install"), Status: aws.String("Pending")},
+			{LifecycleEventName: aws.String("ValidateService"), Status: aws.String("Pending")},
+		},
+	}
+
+	summaries := []*codedeploy.InstanceSummary{done, pending, pending, nil}
+	e := NewEtaEstimator(summaries, nil)
+
+	if r, ok := e.Instance(pending); !ok || r != 90 {
+		t.Errorf("Instance(pending) => %d %t, want 90", r, ok)
+	}
+
+	if _, ok := e.Instance(done); ok {
+		t.Errorf("Instance(done) should not have an eta")
+	}
+
+	// three pending instances, two at a time
+	if r, ok := e.Deployment(summaries, 2); !ok || r != 180 {
+		t.Errorf("Deployment(2) => %d %t, want 180", r, ok)
+	}
+
+	if _, ok := e.Deployment(summaries, 0); ok {
+		t.Errorf("Deployment without known concurrency should not have an eta")
+	}
+
+	if _, ok := NewEtaEstimator([]*codedeploy.InstanceSummary{pending}, nil).Deployment(summaries, 1); ok {
+		t.Errorf("Deployment without any durations should not have an eta")
+	}
+}
@@ -0,0 +1,264 @@
+package watch
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// Event is a change in the state of the watched deployments, published
+// on a Bus for every output to consume independently
+type Event interface {
+	EventTime() time.Time
+	String() string
+}
+
+// DeploymentDiscovered is published the first time a deployment is seen
+type DeploymentDiscovered struct {
+	Time                time.Time
+	DeploymentId        string
+	ApplicationName     string
+	DeploymentGroupName string
+	Status              string
+}
+
+func (e *DeploymentDiscovered) EventTime() time.Time { return e.Time }
+
+func (e *DeploymentDiscovered) String() string {
+	return fmt.Sprintf("Discovered deployment %s %s-%s %s", e.DeploymentId, e.ApplicationName, e.DeploymentGroupName, e.Status)
+}
+
+// DeploymentStatusChanged is published when a known deployment changes status
+type DeploymentStatusChanged struct {
+	Time         time.Time
+	DeploymentId string
+	From         string
+	To           string
+}
+
+func (e *DeploymentStatusChanged) EventTime() time.Time { return e.Time }
+
+func (e *DeploymentStatusChanged) String() string {
+	return fmt.Sprintf("Deployment %s %s -> %s", e.DeploymentId, e.From, e.To)
+}
+
+// InstanceStatusChanged is published when an instance changes status,
+// From is empty the first time the instance's status is known
+type InstanceStatusChanged struct {
+	Time         time.Time
+	DeploymentId string
+	InstanceId   string
+	From         string
+	To           string
+}
+
+func (e *InstanceStatusChanged) EventTime() time.Time { return e.Time }
+
+func (e *InstanceStatusChanged) String() string {
+	return fmt.Sprintf("Instance %s (%s) %s -> %s", e.InstanceId, e.DeploymentId, e.From, e.To)
+}
+
+// LifecycleEventChanged is published when a lifecycle event of an
+// instance changes status
+type LifecycleEventChanged struct {
+	Time               time.Time
+	DeploymentId       string
+	InstanceId         string
+	LifecycleEventName string
+	From               string
+	To                 string
+}
+
+func (e *LifecycleEventChanged) EventTime() time.Time { return e.Time }
+
+func (e *LifecycleEventChanged) String() string {
+	return fmt.Sprintf("Instance %s (%s) %s %s -> %s", e.InstanceId, e.DeploymentId, e.LifecycleEventName, e.From, e.To)
+}
+
+// InstanceScaled is published when an auto scaling group targeted by a
+// deployment launches or terminates an instance
+type InstanceScaled struct {
+	Time         time.Time
+	DeploymentId string
+	InstanceId   string
+	Group        string
+	Cause        ScalingCause
+}
+
+func (e *InstanceScaled) EventTime() time.Time { return e.Time }
+
+func (e *InstanceScaled) String() string {
+	return fmt.Sprintf("Instance %s (%s) %s by %s", e.InstanceId, e.DeploymentId, e.Cause, e.Group)
+}
+
+// TargetHealthChanged is published when the health of an instance in a
+// load balancer or target group changes
+type TargetHealthChanged struct {
+	Time         time.Time
+	DeploymentId string
+	InstanceId   string
+	LoadBalancer string
+	From         string
+	To           string
+	Reason       string
+}
+
+func (e *TargetHealthChanged) EventTime() time.Time { return e.Time }
+
+func (e *TargetHealthChanged) String() string {
+	return fmt.Sprintf("Instance %s (%s) in %s %s -> %s %s", e.InstanceId, e.DeploymentId, e.LoadBalancer, e.From, e.To, e.Reason)
+}
+
+// AlarmStateChanged is published when an alarm that stops a deployment
+// changes state
+type AlarmStateChanged struct {
+	Time         time.Time
+	DeploymentId string
+	AlarmName    string
+	From         string
+	To           string
+	Reason       string
+}
+
+func (e *AlarmStateChanged) EventTime() time.Time { return e.Time }
+
+func (e *AlarmStateChanged) String() string {
+	return fmt.Sprintf("Alarm %s (%s) %s -> %s %s", e.AlarmName, e.DeploymentId, e.From, e.To, e.Reason)
+}
+
+// AgentLogFetched is published when the agent log of an instance was
+// fetched after one of its lifecycle events failed
+type AgentLogFetched struct {
+	Time         time.Time
+	DeploymentId string
+	InstanceId   string
+	Status       string
+}
+
+func (e *AgentLogFetched) EventTime() time.Time { return e.Time }
+
+func (e *AgentLogFetched) String() string {
+	return fmt.Sprintf("Fetched agent log of instance %s (%s) %s", e.InstanceId, e.DeploymentId, e.Status)
+}
+
+// PipelineStageChanged is published when a stage of a followed pipeline
+// execution changes status
+type PipelineStageChanged struct {
+	Time        time.Time
+	Pipeline    string
+	ExecutionId string
+	Stage       string
+	From        string
+	To          string
+}
+
+func (e *PipelineStageChanged) EventTime() time.Time { return e.Time }
+
+func (e *PipelineStageChanged) String() string {
+	return fmt.Sprintf("Pipeline %s stage %s (%s) %s -> %s", e.Pipeline, e.Stage, e.ExecutionId, e.From, e.To)
+}
+
+// Tick is published periodically, so outputs showing elapsed times
+// stay live while nothing changes
+type Tick struct {
+	Time time.Time
+}
+
+func (e *Tick) EventTime() time.Time { return e.Time }
+
+func (e *Tick) String() string {
+	return "Tick"
+}
+
+// deploymentEvent compares the previously known state of a deployment,
+// nil if it was unknown, with its current state
+func deploymentEvent(prev, deployment *codedeploy.DeploymentInfo) Event {
+	status := aws.StringValue(deployment.Status)
+
+	if prev == nil {
+		return &DeploymentDiscovered{time.Now(), aws.StringValue(deployment.DeploymentId), aws.StringValue(deployment.ApplicationName),
+			aws.StringValue(deployment.DeploymentGroupName), status}
+	}
+
+	prevStatus := aws.StringValue(prev.Status)
+	if status == prevStatus {
+		return nil
+	}
+	return &DeploymentStatusChanged{time.Now(), aws.StringValue(deployment.DeploymentId), prevStatus, status}
+}
+
+// Bus delivers published events to every subscriber
+type Bus struct {
+	subscribers []chan Event
+	dropped     int64
+	closed      bool
+	mu          sync.RWMutex
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		[]chan Event{},
+		0,
+		false,
+		sync.RWMutex{},
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// which is closed when the bus is. Events published while the channel's
+// buffer is full are dropped for it, so slow subscribers never hold up
+// the others or the watcher.
+func (b *Bus) Subscribe(buffer int) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+// Publish sends the event to every subscriber with room for it, without
+// blocking, counting the ones it was dropped for
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			atomic.AddInt64(&b.dropped, 1)
+		}
+	}
+}
+
+// Dropped is how many times an event was dropped for a full subscriber
+func (b *Bus) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// Close stops delivering events and closes every subscriber's channel
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+}
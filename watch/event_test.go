@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	first := bus.Subscribe(1)
+	second := bus.Subscribe(1)
+
+	bus.Publish(&Tick{time.Now()})
+	for _, ch := range []<-chan Event{first, second} {
+		if _, ok := (<-ch).(*Tick); !ok {
+			t.Errorf("Subscribe() did not receive the published tick")
+		}
+	}
+
+	// publishing to a full subscriber drops the event for it only
+	bus.Publish(&Tick{time.Now()})
+	<-second
+	bus.Publish(&Tick{time.Now()})
+	if dropped := bus.Dropped(); dropped != 1 {
+		t.Errorf("Dropped() => %d, want 1", dropped)
+	}
+	if _, ok := (<-second).(*Tick); !ok {
+		t.Errorf("Subscribe() did not receive the published tick")
+	}
+
+	bus.Close()
+	bus.Publish(&Tick{time.Now()})
+	if _, ok := <-first; !ok {
+		t.Errorf("Close() dropped a buffered event")
+	}
+	if e, ok := <-first; ok {
+		t.Errorf("Close() => received %v, want closed channel", e)
+	}
+}
+
+func TestRendererEvents(t *testing.T) {
+	renderer := NewRenderer(false, false, nil)
+	renderer.Deployments = append(renderer.Deployments, &codedeploy.DeploymentInfo{DeploymentId: aws.String("d-1"), Status: aws.String("InProgress")})
+	events := renderer.Bus().Subscribe(10)
+
+	summary := func(status, installStatus string) *codedeploy.InstanceSummary {
+		return &codedeploy.InstanceSummary{
+			DeploymentId: aws.String("d-1"),
+			InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+			Status:       aws.String(status),
+			LifecycleEvents: []*codedeploy.LifecycleEvent{
+				{LifecycleEventName: aws.String("Install"), Status: aws.String(installStatus)},
+			},
+		}
+	}
+
+	renderer.Update(summary("Pending", "Pending"))
+	renderer.Update(summary("InProgress", "InProgress"))
+	renderer.Update(summary("InProgress", "InProgress"))
+
+	expected := []string{
+		"Instance i-1 (d-1)  -> Pending",
+		"Instance i-1 (d-1) Pending -> InProgress",
+		"Instance i-1 (d-1) Install Pending -> InProgress",
+	}
+	for _, want := range expected {
+		select {
+		case e := <-events:
+			if e.String() != want {
+				t.Errorf("event => %q, want %q", e, want)
+			}
+		default:
+			t.Errorf("missing event %q", want)
+		}
+	}
+
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %q", e)
+	default:
+	}
+}
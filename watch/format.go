@@ -1,10 +1,12 @@
-package main
+package watch
 
 import (
 	"fmt"
 	"math"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/codedeploy"
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
@@ -27,9 +29,9 @@ func PadLeft(str, pad string, length int) string {
 	}
 }
 
-func DeploymentLine(deployment *codedeploy.DeploymentInfo, numSuccess, numTotal int) string {
+func DeploymentLine(deployment *codedeploy.DeploymentInfo, numSuccess, numTotal int, eta string) string {
 	deployId := StrColor(*deployment.DeploymentId, "cyan")
-	return fmt.Sprintf("%s %s-%s (%d/%d)\n", deployId, *deployment.ApplicationName, *deployment.DeploymentGroupName, numSuccess, numTotal)
+	return fmt.Sprintf("%s %s-%s (%d/%d)%s\n", deployId, *deployment.ApplicationName, *deployment.DeploymentGroupName, numSuccess, numTotal, eta)
 }
 
 func InstanceName(instance *ec2.Instance) string {
@@ -42,11 +44,11 @@ func InstanceName(instance *ec2.Instance) string {
 	return ""
 }
 
-func InstanceLine(instance *ec2.Instance) string {
-	return fmt.Sprintf("  %s (%s)\n", StrColor(InstanceName(instance), "magenta"), *instance.InstanceId)
+func InstanceLine(instance *ec2.Instance, annotations string) string {
+	return fmt.Sprintf("  %s (%s)%s\n", StrColor(InstanceName(instance), "magenta"), *instance.InstanceId, annotations)
 }
 
-func CompactInstanceLine(instance *ec2.Instance, summary *codedeploy.InstanceSummary, maxLen int) string {
+func CompactInstanceLine(instance *ec2.Instance, summary *codedeploy.InstanceSummary, maxLen int, annotations string) string {
 	name := InstanceName(instance)
 	id := *instance.InstanceId
 	var status string
@@ -58,9 +60,9 @@ func CompactInstanceLine(instance *ec2.Instance, summary *codedeploy.InstanceSum
 	duration := DurationStr(LifecycleTotalDuration(summary))
 	instanceType := InstanceType(summary)
 	if instanceType == "" {
-		return fmt.Sprintf("  %s (%s) %s %s\n", PadRight(name, " ", maxLen), id, duration, status)
+		return fmt.Sprintf("  %s (%s) %s %s%s\n", PadRight(name, " ", maxLen), id, duration, status, annotations)
 	} else {
-		return fmt.Sprintf("  %s (%s) %s %s (%s)\n", PadRight(name, " ", maxLen), id, duration, status, instanceType)
+		return fmt.Sprintf("  %s (%s) %s %s (%s)%s\n", PadRight(name, " ", maxLen), id, duration, status, instanceType, annotations)
 	}
 }
 
@@ -139,6 +141,10 @@ func LifecycleEventDuration(lifecycleEvent *codedeploy.LifecycleEvent) int {
 	}
 
 	if lifecycleEvent.EndTime == nil || lifecycleEvent.EndTime.IsZero() {
+		// running events have no end time yet, report time elapsed so far
+		if lifecycleEvent.Status != nil && *lifecycleEvent.Status == "InProgress" {
+			return int(math.Floor(time.Since(*lifecycleEvent.StartTime).Seconds()))
+		}
 		return 0
 	}
 
@@ -149,6 +155,44 @@ func DurationStr(duration int) string {
 	return fmt.Sprintf("%2dm%2ds", duration/60, duration%60)
 }
 
+// FailureBudgetStr shows how many more instances can fail, turning
+// yellow once half the budget is spent and red at its last failure
+func FailureBudgetStr(budget, allowed int, ok bool) string {
+	if !ok {
+		return ""
+	}
+
+	color := "green"
+	if budget <= 1 {
+		color = "red"
+	} else if budget*2 <= allowed {
+		color = "yellow"
+	}
+	return " " + StrColor(fmt.Sprintf("failure budget %d/%d", budget, allowed), color)
+}
+
+func EtaStr(seconds int, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" eta %s", StrColor(strings.TrimSpace(DurationStr(seconds)), "white"))
+}
+
+func StragglerStr(straggler *Straggler) string {
+	if straggler == nil {
+		return ""
+	}
+
+	switch straggler.Lag {
+	case LagStuck:
+		return fmt.Sprintf(" %s", StrColor("STUCK in "+straggler.LifecycleEventName, "red"))
+	case LagSlow:
+		return fmt.Sprintf(" %s", StrColor("slow in "+straggler.LifecycleEventName, "yellow"))
+	default:
+		return ""
+	}
+}
+
 func LifecycleEventName(name string) string {
 	return fmt.Sprintf("%-20s", name)
 }
@@ -159,3 +203,52 @@ func LifecycleEventLine(lifecycleEvent *codedeploy.LifecycleEvent) string {
 	status := StatusStr(*lifecycleEvent.Status)
 	return fmt.Sprintf("    => %s %s %s\n", name, duration, status)
 }
+
+// RevisionStr describes where a deployment's application revision is stored
+func RevisionStr(revision *codedeploy.RevisionLocation) string {
+	if revision == nil {
+		return ""
+	}
+
+	if revision.S3Location != nil {
+		s3 := revision.S3Location
+		str := fmt.Sprintf("s3://%s/%s", aws.StringValue(s3.Bucket), aws.StringValue(s3.Key))
+		if s3.Version != nil {
+			str += " version " + *s3.Version
+		} else if s3.ETag != nil {
+			str += " etag " + *s3.ETag
+		}
+		return str
+	}
+
+	if revision.GitHubLocation != nil {
+		github := revision.GitHubLocation
+		return fmt.Sprintf("github.com/%s@%s", aws.StringValue(github.Repository), aws.StringValue(github.CommitId))
+	}
+
+	return aws.StringValue(revision.RevisionType)
+}
+
+func TransitionLine(t *Transition) string {
+	color := "white"
+	switch t.Kind {
+	case DeploymentSucceeded:
+		color = "green"
+	case DeploymentFailed, DeploymentStopped, LifecycleEventFailed, InstanceUnhealthy, AlarmTriggered:
+		color = "red"
+	case InstanceStuck:
+		color = "yellow"
+	}
+
+	line := fmt.Sprintf("%s-%s %s", t.ApplicationName, t.DeploymentGroupName, t.DeploymentId)
+	if t.InstanceName != "" {
+		line += " " + t.InstanceName
+	} else if t.InstanceId != "" {
+		line += " " + t.InstanceId
+	}
+	if t.LifecycleEventName != "" {
+		line += " " + t.LifecycleEventName
+	}
+
+	return fmt.Sprintf("  %s %s %s\n", t.Time.Local().Format("15:04:05"), StrColor(string(t.Kind), color), line)
+}
@@ -0,0 +1,239 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// LifecycleEventOrder is the order in which CodeDeploy runs
+// lifecycle events on an instance, including the traffic hooks
+// used by load balanced and blue/green deployments
+var LifecycleEventOrder = []string{
+	"BeforeBlockTraffic",
+	"BlockTraffic",
+	"AfterBlockTraffic",
+	"ApplicationStop",
+	"DownloadBundle",
+	"BeforeInstall",
+	"Install",
+	"AfterInstall",
+	"ApplicationStart",
+	"ValidateService",
+	"BeforeAllowTraffic",
+	"AllowTraffic",
+	"AfterAllowTraffic",
+}
+
+// DurationStats holds percentiles, in seconds, of a set of durations
+type DurationStats struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	P50   int    `json:"p50"`
+	P90   int    `json:"p90"`
+	P99   int    `json:"p99"`
+}
+
+func NewDurationStats(name string, durations []int) *DurationStats {
+	sorted := make([]int, len(durations))
+	copy(sorted, durations)
+	sort.Ints(sorted)
+
+	return &DurationStats{
+		Name:  name,
+		Count: len(sorted),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P99:   percentile(sorted, 99),
+	}
+}
+
+// percentile uses the nearest-rank method on an already sorted slice
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100.0 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank-1]
+}
+
+// DurationSamples collects lifecycle event and whole-instance
+// durations, in seconds, from completed instance summaries
+type DurationSamples struct {
+	events   map[string][]int
+	instance []int
+}
+
+func NewDurationSamples() *DurationSamples {
+	return &DurationSamples{
+		map[string][]int{},
+		[]int{},
+	}
+}
+
+func (s *DurationSamples) Add(summary *codedeploy.InstanceSummary) {
+	if summary == nil {
+		return
+	}
+
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		if lifecycleEvent.LifecycleEventName == nil || lifecycleEvent.Status == nil {
+			continue
+		}
+		if *lifecycleEvent.Status != "Succeeded" || lifecycleEvent.EndTime == nil {
+			continue
+		}
+
+		name := *lifecycleEvent.LifecycleEventName
+		s.events[name] = append(s.events[name], LifecycleEventDuration(lifecycleEvent))
+	}
+
+	if summary.Status != nil && *summary.Status == "Succeeded" {
+		s.instance = append(s.instance, LifecycleTotalDuration(summary))
+	}
+}
+
+// EventNames returns the names of all sampled lifecycle events,
+// in the order CodeDeploy runs them
+func (s *DurationSamples) EventNames() []string {
+	names := []string{}
+	for _, name := range LifecycleEventOrder {
+		if _, ok := s.events[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	unknown := []string{}
+	for name := range s.events {
+		if lifecycleEventIndex(name) < 0 {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	return append(names, unknown...)
+}
+
+func lifecycleEventIndex(name string) int {
+	for i, n := range LifecycleEventOrder {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GroupHistory summarizes historical lifecycle event durations
+// for a single deployment group
+type GroupHistory struct {
+	ApplicationName     string           `json:"applicationName"`
+	DeploymentGroupName string           `json:"deploymentGroupName"`
+	Start               time.Time        `json:"start"`
+	End                 time.Time        `json:"end"`
+	Deployments         int              `json:"deployments"`
+	LifecycleEvents     []*DurationStats `json:"lifecycleEvents"`
+	Instance            *DurationStats   `json:"instance"`
+}
+
+func NewGroupHistory(applicationName, deploymentGroupName string, start, end time.Time, deployments int, samples *DurationSamples) *GroupHistory {
+	h := &GroupHistory{
+		ApplicationName:     applicationName,
+		DeploymentGroupName: deploymentGroupName,
+		Start:               start,
+		End:                 end,
+		Deployments:         deployments,
+		LifecycleEvents:     []*DurationStats{},
+		Instance:            NewDurationStats("Instance", samples.instance),
+	}
+
+	for _, name := range samples.EventNames() {
+		h.LifecycleEvents = append(h.LifecycleEvents, NewDurationStats(name, samples.events[name]))
+	}
+
+	return h
+}
+
+// Event returns the stats for the named lifecycle event, or nil
+// if it was never seen in the analyzed deployments
+func (h *GroupHistory) Event(name string) *DurationStats {
+	if h == nil {
+		return nil
+	}
+
+	for _, stats := range h.LifecycleEvents {
+		if stats.Name == name {
+			return stats
+		}
+	}
+
+	return nil
+}
+
+// AnalyzeHistory collects lifecycle event durations from up to
+// maxDeployments successful deployments of a deployment group
+// created between start and end
+func AnalyzeHistory(aws Aws, applicationName, deploymentGroupName string, start, end time.Time, maxDeployments int) (*GroupHistory, error) {
+	deploymentIds, err := aws.ListDeploymentsCreatedBetween(applicationName, deploymentGroupName, []string{"Succeeded"}, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxDeployments > 0 && len(deploymentIds) > maxDeployments {
+		deploymentIds = deploymentIds[:maxDeployments]
+	}
+
+	samples := NewDurationSamples()
+
+	for _, deploymentId := range deploymentIds {
+		instanceIds, err := aws.ListDeploymentInstances(deploymentId)
+		if err != nil {
+			return nil, err
+		}
+
+		summaries, err := aws.BatchGetDeploymentInstances(deploymentId, instanceIds)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range summaries {
+			samples.Add(summary)
+		}
+	}
+
+	return NewGroupHistory(applicationName, deploymentGroupName, start, end, len(deploymentIds), samples), nil
+}
+
+func WriteHistoryTable(w io.Writer, h *GroupHistory) error {
+	fmt.Fprintf(w, "%s-%s: %d deployments from %s to %s\n\n",
+		h.ApplicationName, h.DeploymentGroupName, h.Deployments,
+		h.Start.Format(time.RFC3339), h.End.Format(time.RFC3339))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "EVENT\tCOUNT\tP50\tP90\tP99")
+	for _, stats := range append(h.LifecycleEvents, h.Instance) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", stats.Name, stats.Count,
+			DurationStr(stats.P50), DurationStr(stats.P90), DurationStr(stats.P99))
+	}
+
+	return tw.Flush()
+}
+
+func WriteHistoryJson(w io.Writer, h *GroupHistory) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestPercentile(t *testing.T) {
+	for _, tt := range []struct {
+		a []int
+		p float64
+		r int
+	}{
+		{[]int{}, 50, 0},
+		{[]int{7}, 50, 7},
+		{[]int{7}, 99, 7},
+		{[]int{1, 2, 3, 4}, 50, 2},
+		{[]int{1, 2, 3, 4}, 90, 4},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 90, 9},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 99, 10},
+	} {
+		r := percentile(tt.a, tt.p)
+		if r != tt.r {
+			t.Errorf("percentile(%v, %f) => %d, want %d", tt.a, tt.p, r, tt.r)
+		}
+	}
+}
+
+func testLifecycleEvent(name, status string, start time.Time, seconds int) *codedeploy.LifecycleEvent {
+	lce := &codedeploy.LifecycleEvent{
+		LifecycleEventName: aws.String(name),
+		Status:             aws.String(status),
+		StartTime:          aws.Time(start),
+	}
+	if seconds >= 0 {
+		lce.EndTime = aws.Time(start.Add(time.Duration(seconds) * time.Second))
+	}
+	return lce
+}
+
+func TestDurationSamples(t *testing.T) {
+	now := time.Now()
+	samples := NewDurationSamples()
+
+	samples.Add(&codedeploy.InstanceSummary{
+		Status: aws.String("Succeeded"),
+		LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("ValidateService", "Succeeded", now, 30),
+			testLifecycleEvent("ApplicationStop", "Succeeded", now, 10),
+		},
+	})
+	samples.Add(&codedeploy.InstanceSummary{
+		Status: aws.String("Failed"),
+		LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("ApplicationStop", "Succeeded", now, 20),
+			testLifecycleEvent("ValidateService", "Failed", now, 90),
+			testLifecycleEvent("CustomHook", "Succeeded", now, 5),
+		},
+	})
+
+	h := NewGroupHistory("app", "group", now, now, 2, samples)
+
+	names := []string{}
+	for _, stats := range h.LifecycleEvents {
+		names = append(names, stats.Name)
+	}
+	if len(names) != 3 || names[0] != "ApplicationStop" || names[1] != "ValidateService" || names[2] != "CustomHook" {
+		t.Errorf("lifecycle event order => %v", names)
+	}
+
+	if stats := h.Event("ValidateService"); stats == nil || stats.Count != 1 || stats.P99 != 30 {
+		t.Errorf("failed lifecycle events should not be sampled => %+v", stats)
+	}
+
+	if stats := h.Event("ApplicationStop"); stats == nil || stats.Count != 2 || stats.P50 != 10 || stats.P90 != 20 {
+		t.Errorf("ApplicationStop stats => %+v", stats)
+	}
+
+	if h.Instance.Count != 1 || h.Instance.P50 != 40 {
+		t.Errorf("only succeeded instances should be sampled => %+v", h.Instance)
+	}
+}
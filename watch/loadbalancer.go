@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// TargetHealth is the health of an instance in a classic load balancer
+// or target group
+type TargetHealth struct {
+	LoadBalancer string `json:"loadBalancer"`
+	State        string `json:"state"`
+	Reason       string `json:"reason,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Healthy is true once the load balancer routes traffic to the instance
+func (h *TargetHealth) Healthy() bool {
+	return h.State == "InService" || h.State == "healthy"
+}
+
+// Unhealthy is true when the load balancer does not route traffic to the
+// instance, as opposed to the instance still being registered or checked
+func (h *TargetHealth) Unhealthy() bool {
+	switch h.State {
+	case "OutOfService", "unhealthy", "unused", "draining", "unavailable":
+		return true
+	default:
+		return false
+	}
+}
+
+// loadBalancerNames lists the classic load balancers of a deployment group.
+// The target groups of application and network load balancers are not
+// part of the deployment group info known to this version of the sdk, so
+// they have to be given separately.
+func loadBalancerNames(group *codedeploy.DeploymentGroupInfo) []string {
+	names := []string{}
+	if group.LoadBalancerInfo == nil {
+		return names
+	}
+	for _, info := range group.LoadBalancerInfo.ElbInfoList {
+		names = append(names, aws.StringValue(info.Name))
+	}
+	return names
+}
+
+// LoadBalancerHealth fetches the health of every instance registered
+// with the classic load balancers and target groups, by instance id
+func LoadBalancerHealth(a Aws, loadBalancers, targetGroups []string) (map[string][]*TargetHealth, error) {
+	health := map[string][]*TargetHealth{}
+
+	for _, name := range loadBalancers {
+		states, err := a.DescribeInstanceHealth(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range states {
+			instanceId := aws.StringValue(state.InstanceId)
+			health[instanceId] = append(health[instanceId], elbTargetHealth(name, state))
+		}
+	}
+
+	for _, name := range targetGroups {
+		descriptions, err := a.DescribeTargetHealth(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, description := range descriptions {
+			if description.Target == nil {
+				continue
+			}
+			instanceId := aws.StringValue(description.Target.Id)
+			health[instanceId] = append(health[instanceId], elbv2TargetHealth(name, description.TargetHealth))
+		}
+	}
+
+	return health, nil
+}
+
+func elbTargetHealth(name string, state *elb.InstanceState) *TargetHealth {
+	return &TargetHealth{
+		LoadBalancer: name,
+		State:        aws.StringValue(state.State),
+		Reason:       aws.StringValue(state.ReasonCode),
+		Description:  aws.StringValue(state.Description),
+	}
+}
+
+func elbv2TargetHealth(name string, health *elbv2.TargetHealth) *TargetHealth {
+	// target groups may be given by arn, show their name
+	if i := strings.Index(name, ":targetgroup/"); i >= 0 {
+		name = strings.Split(name[i+len(":targetgroup/"):], "/")[0]
+	}
+
+	h := &TargetHealth{LoadBalancer: name}
+	if health != nil {
+		h.State = aws.StringValue(health.State)
+		h.Reason = aws.StringValue(health.Reason)
+		h.Description = aws.StringValue(health.Description)
+	}
+	return h
+}
+
+// unhealthyTarget returns the first load balancer an instance that
+// succeeded is unhealthy in, nil if there is none
+func unhealthyTarget(summary *codedeploy.InstanceSummary, health []*TargetHealth) *TargetHealth {
+	if summary == nil || aws.StringValue(summary.Status) != "Succeeded" {
+		return nil
+	}
+
+	for _, h := range health {
+		if h.Unhealthy() {
+			return h
+		}
+	}
+	return nil
+}
+
+// TargetHealthStr shows the health of an instance in each load balancer,
+// flagging instances that succeeded but are unhealthy
+func TargetHealthStr(summary *codedeploy.InstanceSummary, health []*TargetHealth) string {
+	if h := unhealthyTarget(summary, health); h != nil {
+		return " " + StrColor(fmt.Sprintf("UNHEALTHY in %s", h.LoadBalancer), "red") + targetHealthReason(h)
+	}
+
+	str := ""
+	for _, h := range health {
+		color := "yellow"
+		if h.Healthy() {
+			color = "green"
+		} else if h.Unhealthy() {
+			color = "red"
+		}
+		str += fmt.Sprintf(" lb %s %s%s", h.LoadBalancer, StrColor(h.State, color), targetHealthReason(h))
+	}
+	return str
+}
+
+func targetHealthReason(h *TargetHealth) string {
+	if h.Reason == "" || h.Reason == "N/A" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", h.Reason)
+}
@@ -0,0 +1,46 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+func TestUnhealthyTarget(t *testing.T) {
+	for _, tt := range []struct {
+		status  string
+		states  []string
+		flagged bool
+	}{
+		{"Succeeded", []string{"InService"}, false},
+		{"Succeeded", []string{"healthy", "OutOfService"}, true},
+		{"Succeeded", []string{"unhealthy"}, true},
+		{"Succeeded", []string{"initial"}, false},
+		{"InProgress", []string{"OutOfService"}, false},
+		{"Succeeded", []string{}, false},
+	} {
+		health := []*TargetHealth{}
+		for _, state := range tt.states {
+			health = append(health, &TargetHealth{LoadBalancer: "web", State: state})
+		}
+		summary := &codedeploy.InstanceSummary{Status: aws.String(tt.status)}
+
+		if flagged := unhealthyTarget(summary, health) != nil; flagged != tt.flagged {
+			t.Errorf("unhealthyTarget(%s, %v) => %t, want %t", tt.status, tt.states, flagged, tt.flagged)
+		}
+	}
+}
+
+func TestElbv2TargetHealth(t *testing.T) {
+	arn := "arn:aws:elasticloadbalancing:us-east-1:123:targetgroup/web-tg/73e2d6bc24d8a067"
+	h := elbv2TargetHealth(arn, &elbv2.TargetHealth{
+		State:  aws.String("unhealthy"),
+		Reason: aws.String("Target.Timeout"),
+	})
+
+	if h.LoadBalancer != "web-tg" || h.State != "unhealthy" || h.Reason != "Target.Timeout" {
+		t.Errorf("elbv2TargetHealth() => %+v", h)
+	}
+}
@@ -0,0 +1,169 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// maxLogStreams is how many log streams FilterLogEvents accepts at once
+const maxLogStreams = 100
+
+// LogSource is where the logs of an application's instances are shipped
+// to in CloudWatch Logs
+type LogSource struct {
+	Group string
+	// StreamPattern is the prefix of the names of an instance's log
+	// streams, with {instance_id} replaced by the instance id
+	StreamPattern string
+}
+
+// LogSources are the log sources of applications by name, with the empty
+// name used for applications without one of their own
+type LogSources map[string]*LogSource
+
+// ParseLogSource parses [APPLICATION=]LOG_GROUP[:STREAM_PATTERN], where
+// the stream pattern defaults to the instance id
+func ParseLogSource(value string) (string, *LogSource, error) {
+	application := ""
+	if i := strings.Index(value, "="); i >= 0 {
+		application = value[:i]
+		value = value[i+1:]
+	}
+
+	source := &LogSource{value, "{instance_id}"}
+	if i := strings.Index(value, ":"); i >= 0 {
+		source.Group = value[:i]
+		source.StreamPattern = value[i+1:]
+	}
+
+	if source.Group == "" {
+		return "", nil, errors.New("log group is required")
+	}
+	if !strings.Contains(source.StreamPattern, "{instance_id}") {
+		return "", nil, fmt.Errorf("log stream pattern must contain {instance_id}: %s", source.StreamPattern)
+	}
+
+	return application, source, nil
+}
+
+// Source returns the log source of an application, nil if there is none
+func (s LogSources) Source(application string) *LogSource {
+	if source, ok := s[application]; ok {
+		return source
+	}
+	return s[""]
+}
+
+// StreamPrefix is the prefix of the names of an instance's log streams
+func (s *LogSource) StreamPrefix(instanceId string) string {
+	return strings.Replace(s.StreamPattern, "{instance_id}", instanceId, -1)
+}
+
+// LogTailer follows the last lines an instance logged during a deployment
+type LogTailer struct {
+	InstanceId string
+
+	aws      Aws
+	source   *LogSource
+	start    time.Time
+	end      time.Time
+	max      int
+	lines    []string
+	last     int64
+	lastSeen *Set
+}
+
+// NewLogTailer tails the logs of an instance within the time window of a
+// deployment, keeping the last max lines
+func NewLogTailer(aws Aws, source *LogSource, deployment *codedeploy.DeploymentInfo, instanceId string, max int) *LogTailer {
+	start := time.Now()
+	if deployment.CreateTime != nil {
+		start = *deployment.CreateTime
+	}
+
+	end := time.Time{}
+	if deployment.CompleteTime != nil {
+		end = *deployment.CompleteTime
+	}
+
+	return &LogTailer{
+		instanceId,
+		aws,
+		source,
+		start,
+		end,
+		max,
+		[]string{},
+		0,
+		NewSet(),
+	}
+}
+
+// Poll fetches the events logged since the last poll and returns the
+// last lines logged so far
+func (t *LogTailer) Poll() ([]string, error) {
+	streams, err := t.aws.DescribeLogStreams(t.source.Group, t.source.StreamPrefix(t.InstanceId))
+	if err != nil {
+		return t.lines, err
+	}
+	if len(streams) == 0 {
+		return t.lines, fmt.Errorf("no log streams starting with %s in %s", t.source.StreamPrefix(t.InstanceId), t.source.Group)
+	}
+	if len(streams) > maxLogStreams {
+		streams = streams[:maxLogStreams]
+	}
+
+	start := t.start
+	if t.last > 0 {
+		start = time.Unix(0, t.last*int64(time.Millisecond))
+	}
+
+	var nextToken *string
+	for {
+		events, token, err := t.aws.FilterLogEvents(t.source.Group, streams, start, t.end, nextToken)
+		if err != nil {
+			return t.lines, err
+		}
+
+		for _, event := range events {
+			timestamp := aws.Int64Value(event.Timestamp)
+			eventId := aws.StringValue(event.EventId)
+
+			// the next poll starts at the last timestamp seen, skip the
+			// events at that timestamp that were already seen
+			if timestamp == t.last && t.lastSeen.Has(eventId) {
+				continue
+			}
+			if timestamp > t.last {
+				t.last = timestamp
+				t.lastSeen = NewSet()
+			}
+			t.lastSeen.Add(eventId)
+
+			t.add(event.LogStreamName, timestamp, aws.StringValue(event.Message))
+		}
+
+		if token == nil {
+			break
+		}
+		nextToken = token
+	}
+
+	return t.lines, nil
+}
+
+func (t *LogTailer) add(stream *string, timestamp int64, message string) {
+	at := time.Unix(0, timestamp*int64(time.Millisecond)).Local().Format("15:04:05")
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		t.lines = append(t.lines, fmt.Sprintf("%s %s %s", at, aws.StringValue(stream), line))
+	}
+
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestParseLogSource(t *testing.T) {
+	for _, tt := range []struct {
+		value       string
+		application string
+		group       string
+		prefix      string
+		err         bool
+	}{
+		{"/codedeploy", "", "/codedeploy", "i-1", false},
+		{"web=/codedeploy/web", "web", "/codedeploy/web", "i-1", false},
+		{"web=/codedeploy/web:agent/{instance_id}/", "web", "/codedeploy/web", "agent/i-1/", false},
+		{"web=/codedeploy/web:agent", "", "", "", true},
+		{"web=", "", "", "", true},
+	} {
+		application, source, err := ParseLogSource(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseLogSource(%s) => no error", tt.value)
+			}
+			continue
+		}
+		if err != nil || application != tt.application || source.Group != tt.group || source.StreamPrefix("i-1") != tt.prefix {
+			t.Errorf("ParseLogSource(%s) => %s, %+v, %v", tt.value, application, source, err)
+		}
+	}
+}
+
+// fakeLogsAws serves log events logged after a poll started
+type fakeLogsAws struct {
+	fakeAws
+	events []*cloudwatchlogs.FilteredLogEvent
+}
+
+func (f *fakeLogsAws) DescribeLogStreams(string, string) ([]string, error) {
+	return []string{"i-1/agent"}, nil
+}
+
+func (f *fakeLogsAws) FilterLogEvents(group string, streams []string, start, end time.Time, nextToken *string) ([]*cloudwatchlogs.FilteredLogEvent, *string, error) {
+	events := []*cloudwatchlogs.FilteredLogEvent{}
+	for _, event := range f.events {
+		if *event.Timestamp >= aws.TimeUnixMilli(start) {
+			events = append(events, event)
+		}
+	}
+	return events, nil, nil
+}
+
+func testLogEvent(id string, timestamp int64, message string) *cloudwatchlogs.FilteredLogEvent {
+	return &cloudwatchlogs.FilteredLogEvent{
+		EventId:       aws.String(id),
+		LogStreamName: aws.String("i-1/agent"),
+		Timestamp:     aws.Int64(timestamp),
+		Message:       aws.String(message),
+	}
+}
+
+func TestLogTailer(t *testing.T) {
+	created := time.Unix(1000, 0)
+	fake := &fakeLogsAws{events: []*cloudwatchlogs.FilteredLogEvent{
+		testLogEvent("1", 1000000, "one"),
+		testLogEvent("2", 1001000, "two\nthree\n"),
+	}}
+
+	tailer := NewLogTailer(fake, &LogSource{"/codedeploy", "{instance_id}"}, &codedeploy.DeploymentInfo{CreateTime: &created}, "i-1", 3)
+
+	lines, err := tailer.Poll()
+	if err != nil || len(lines) != 3 {
+		t.Fatalf("Poll() => %v, %v", lines, err)
+	}
+
+	fake.events = append(fake.events, testLogEvent("3", 1001000, "four"), testLogEvent("4", 1002000, "five"))
+	lines, err = tailer.Poll()
+	if err != nil || len(lines) != 3 {
+		t.Fatalf("Poll() => %v, %v", lines, err)
+	}
+
+	for i, want := range []string{"three", "four", "five"} {
+		if lines[i][len(lines[i])-len(want):] != want {
+			t.Errorf("Poll()[%d] => %s, want %s", i, lines[i], want)
+		}
+	}
+}
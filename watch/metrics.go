@@ -0,0 +1,227 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// upper bounds, in seconds, of the lifecycle event duration histogram buckets
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.counts[i] += 1
+		}
+	}
+	h.count += 1
+	h.sum += v
+}
+
+// labelEscaper escapes the characters the prometheus text format
+// does not allow unescaped in label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel quotes a label value for the prometheus text format
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// ApiCalls counts AWS api calls and errors by service and operation
+type ApiCalls struct {
+	calls  map[string]uint64
+	errors map[string]uint64
+	mu     sync.Mutex
+}
+
+func NewApiCalls() *ApiCalls {
+	return &ApiCalls{
+		map[string]uint64{},
+		map[string]uint64{},
+		sync.Mutex{},
+	}
+}
+
+// Record is an aws request handler, run once each request completes
+func (c *ApiCalls) Record(r *request.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	labels := fmt.Sprintf(`service=%s,operation=%s`, quoteLabel(r.ClientInfo.ServiceName), quoteLabel(r.Operation.Name))
+	c.calls[labels] += 1
+	if r.Error != nil {
+		c.errors[labels] += 1
+	}
+}
+
+// apiCalls is shared by every aws session created by NewAwsEnv
+var apiCalls = NewApiCalls()
+
+// Metrics exposes deployment progress in the prometheus text format
+type Metrics struct {
+	renderer  *Renderer
+	throttle  *Throttle
+	durations map[string]*histogram
+	observed  map[string]*Set
+	mu        sync.Mutex
+}
+
+func NewMetrics(renderer *Renderer, throttle *Throttle) *Metrics {
+	return &Metrics{
+		renderer,
+		throttle,
+		map[string]*histogram{},
+		map[string]*Set{},
+		sync.Mutex{},
+	}
+}
+
+// Update observes the duration of every lifecycle event that completed
+// since the last update
+func (m *Metrics) Update(snapshot *Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := map[string]bool{}
+
+	for _, d := range snapshot.Deployments {
+		current[d.DeploymentId] = true
+		if _, ok := m.observed[d.DeploymentId]; !ok {
+			m.observed[d.DeploymentId] = NewSet()
+		}
+		observed := m.observed[d.DeploymentId]
+
+		for _, i := range d.Instances {
+			for _, e := range i.LifecycleEvents {
+				if e.EndTime == nil || (e.Status != "Succeeded" && e.Status != "Failed") {
+					continue
+				}
+
+				key := i.InstanceId + "/" + e.Name
+				if observed.Has(key) {
+					continue
+				}
+				observed.Add(key)
+
+				labels := fmt.Sprintf(`application=%s,deployment_group=%s,lifecycle_event=%s,status=%s`,
+					quoteLabel(d.ApplicationName), quoteLabel(d.DeploymentGroupName), quoteLabel(e.Name), quoteLabel(e.Status))
+				h, ok := m.durations[labels]
+				if !ok {
+					h = &histogram{counts: make([]uint64, len(durationBuckets))}
+					m.durations[labels] = h
+				}
+				h.observe(float64(e.Duration))
+			}
+		}
+	}
+
+	// forget deployments that are no longer watched
+	for deploymentId := range m.observed {
+		if !current[deploymentId] {
+			delete(m.observed, deploymentId)
+		}
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(m.Bytes())
+}
+
+func (m *Metrics) Bytes() []byte {
+	var b bytes.Buffer
+
+	snapshot := m.renderer.Snapshot()
+
+	instances := map[string]int{}
+	writeHeader(&b, "deploywatch_deployment_status", "gauge", "Current status of each watched deployment, 1 for the current status")
+	for _, d := range snapshot.Deployments {
+		fmt.Fprintf(&b, "deploywatch_deployment_status{application=%s,deployment_group=%s,deployment_id=%s,status=%s} 1\n",
+			quoteLabel(d.ApplicationName), quoteLabel(d.DeploymentGroupName), quoteLabel(d.DeploymentId), quoteLabel(d.Status))
+
+		if IsDeploymentStatusDone(d.Status) {
+			continue
+		}
+		for _, i := range d.Instances {
+			instances[fmt.Sprintf(`application=%s,deployment_group=%s,status=%s`,
+				quoteLabel(d.ApplicationName), quoteLabel(d.DeploymentGroupName), quoteLabel(i.Status))] += 1
+		}
+	}
+
+	writeHeader(&b, "deploywatch_instances", "gauge", "Number of instances in running deployments by status")
+	for _, labels := range sortedKeys(instances) {
+		fmt.Fprintf(&b, "deploywatch_instances{%s} %d\n", labels, instances[labels])
+	}
+
+	m.mu.Lock()
+	writeHeader(&b, "deploywatch_lifecycle_event_duration_seconds", "histogram", "Duration of completed lifecycle events")
+	labels := []string{}
+	for l := range m.durations {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		h := m.durations[l]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(&b, "deploywatch_lifecycle_event_duration_seconds_bucket{%s,le=\"%g\"} %d\n", l, bound, h.counts[i])
+		}
+		fmt.Fprintf(&b, "deploywatch_lifecycle_event_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, h.count)
+		fmt.Fprintf(&b, "deploywatch_lifecycle_event_duration_seconds_sum{%s} %g\n", l, h.sum)
+		fmt.Fprintf(&b, "deploywatch_lifecycle_event_duration_seconds_count{%s} %d\n", l, h.count)
+	}
+	m.mu.Unlock()
+
+	apiCalls.mu.Lock()
+	writeHeader(&b, "deploywatch_aws_api_calls_total", "counter", "Number of AWS api calls by operation")
+	for _, l := range sortedKeys64(apiCalls.calls) {
+		fmt.Fprintf(&b, "deploywatch_aws_api_calls_total{%s} %d\n", l, apiCalls.calls[l])
+	}
+	writeHeader(&b, "deploywatch_aws_api_errors_total", "counter", "Number of failed AWS api calls by operation")
+	for _, l := range sortedKeys64(apiCalls.errors) {
+		fmt.Fprintf(&b, "deploywatch_aws_api_errors_total{%s} %d\n", l, apiCalls.errors[l])
+	}
+	apiCalls.mu.Unlock()
+
+	writeHeader(&b, "deploywatch_dropped_events_total", "counter", "Number of events dropped for subscribers with a full buffer")
+	fmt.Fprintf(&b, "deploywatch_dropped_events_total %d\n", m.renderer.Bus().Dropped())
+
+	writeHeader(&b, "deploywatch_throttle_sleep_seconds", "gauge", "Current instance summary throttle sleep")
+	fmt.Fprintf(&b, "deploywatch_throttle_sleep_seconds %g\n", m.throttle.Current().Seconds())
+
+	return b.Bytes()
+}
+
+func writeHeader(b *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, strings.Replace(help, "\n", " ", -1))
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys64(m map[string]uint64) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
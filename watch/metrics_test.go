@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsUpdate(t *testing.T) {
+	now := time.Now()
+	snapshot := &Snapshot{
+		Deployments: []*DeploymentSnapshot{
+			{
+				DeploymentId:        "d-1",
+				ApplicationName:     "app",
+				DeploymentGroupName: "group",
+				Status:              "InProgress",
+				Instances: []*InstanceSnapshot{
+					{
+						InstanceId: "i-1",
+						Status:     "InProgress",
+						LifecycleEvents: []*LifecycleEventSnapshot{
+							{Name: "Install", Status: "Succeeded", EndTime: &now, Duration: 42},
+							{Name: "ValidateService", Status: "InProgress", Duration: 3},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	m := NewMetrics(NewRenderer(false, false, nil), NewThrottle(5.0, 0.025))
+
+	// completed events are only observed once
+	m.Update(snapshot)
+	m.Update(snapshot)
+
+	out := string(m.Bytes())
+	for _, want := range []string{
+		`deploywatch_lifecycle_event_duration_seconds_bucket{application="app",deployment_group="group",lifecycle_event="Install",status="Succeeded",le="30"} 0`,
+		`deploywatch_lifecycle_event_duration_seconds_bucket{application="app",deployment_group="group",lifecycle_event="Install",status="Succeeded",le="60"} 1`,
+		`deploywatch_lifecycle_event_duration_seconds_count{application="app",deployment_group="group",lifecycle_event="Install",status="Succeeded"} 1`,
+		`deploywatch_dropped_events_total 0`,
+		`deploywatch_throttle_sleep_seconds 5`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %s\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, `lifecycle_event="ValidateService"`) {
+		t.Errorf("running lifecycle events should not be observed\n%s", out)
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  string
+	}{
+		{"web", `"web"`},
+		{`C:\deploy`, `"C:\\deploy"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"two\nlines", `"two\nlines"`},
+		// only backslash, double quote and newline are escaped
+		{"tab\tünïcode", "\"tab\tünïcode\""},
+	} {
+		if got := quoteLabel(tt.value); got != tt.want {
+			t.Errorf("quoteLabel(%q) => %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	// receiveErrorWait is how long to wait after failing to receive messages
+	receiveErrorWait = 5 * time.Second
+	// receiveEmptyWait is how long to wait after receiving no messages, in
+	// case the queue returns right away instead of waiting for messages
+	receiveEmptyWait = time.Second
+)
+
+// Queue receives messages from a queue of CodeDeploy notifications
+type Queue interface {
+	// Receive waits for messages, returning their bodies along with the
+	// handles to delete them by
+	Receive() ([]string, []string, error)
+	Delete(string) error
+}
+
+type sqsQueue struct {
+	url    string
+	sqsSvc *sqs.SQS
+}
+
+// NewSqsQueue receives messages from an SQS queue. An endpoint, if given,
+// replaces the SQS endpoint, to use a local SQS-compatible queue instead.
+func NewSqsQueue(url, endpoint string) Queue {
+	config := aws.NewConfig()
+	if endpoint != "" {
+		config.WithEndpoint(endpoint)
+	}
+
+	return &sqsQueue{url, sqs.New(newSession(), config)}
+}
+
+func (q *sqsQueue) Receive() ([]string, []string, error) {
+	input := &sqs.ReceiveMessageInput{}
+	input.SetQueueUrl(q.url)
+	input.SetMaxNumberOfMessages(10)
+	input.SetWaitTimeSeconds(20)
+
+	output, err := q.sqsSvc.ReceiveMessage(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bodies := []string{}
+	handles := []string{}
+	for _, message := range output.Messages {
+		bodies = append(bodies, aws.StringValue(message.Body))
+		handles = append(handles, aws.StringValue(message.ReceiptHandle))
+	}
+	return bodies, handles, nil
+}
+
+func (q *sqsQueue) Delete(receiptHandle string) error {
+	input := &sqs.DeleteMessageInput{}
+	input.SetQueueUrl(q.url)
+	input.SetReceiptHandle(receiptHandle)
+
+	_, err := q.sqsSvc.DeleteMessage(input)
+	return err
+}
+
+// Notification is a deployment or instance state change, InstanceId is
+// empty for deployment state changes
+type Notification struct {
+	DeploymentId        string
+	ApplicationName     string
+	DeploymentGroupName string
+	InstanceId          string
+	Status              string
+}
+
+// cloudWatchEvent is a CodeDeploy state-change event from CloudWatch Events
+type cloudWatchEvent struct {
+	Source     string `json:"source"`
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		DeploymentId    string `json:"deploymentId"`
+		Application     string `json:"application"`
+		DeploymentGroup string `json:"deploymentGroup"`
+		InstanceId      string `json:"instanceId"`
+		State           string `json:"state"`
+	} `json:"detail"`
+}
+
+// snsEnvelope is a message delivered to SQS by an SNS subscription
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// triggerMessage is the message of a CodeDeploy SNS trigger
+type triggerMessage struct {
+	DeploymentId        string `json:"deploymentId"`
+	ApplicationName     string `json:"applicationName"`
+	DeploymentGroupName string `json:"deploymentGroupName"`
+	Status              string `json:"status"`
+	InstanceId          string `json:"instanceId"`
+	InstanceStatus      string `json:"instanceStatus"`
+}
+
+// ParseNotification parses a CodeDeploy state-change event delivered by
+// CloudWatch Events, or a CodeDeploy trigger delivered by SNS, either raw
+// or in its SNS envelope
+func ParseNotification(body string) (*Notification, error) {
+	var envelope snsEnvelope
+	err := json.Unmarshal([]byte(body), &envelope)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var event cloudWatchEvent
+	err = json.Unmarshal([]byte(body), &event)
+	if err != nil {
+		return nil, err
+	}
+	if event.Source == "aws.codedeploy" {
+		n := &Notification{
+			DeploymentId:        event.Detail.DeploymentId,
+			ApplicationName:     event.Detail.Application,
+			DeploymentGroupName: event.Detail.DeploymentGroup,
+			Status:              notificationStatus(event.Detail.State),
+		}
+		if strings.HasPrefix(event.DetailType, "CodeDeploy Instance") {
+			n.InstanceId = instanceIdFromArn(event.Detail.InstanceId)
+		}
+		return validNotification(n)
+	}
+
+	var trigger triggerMessage
+	err = json.Unmarshal([]byte(body), &trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notification{
+		DeploymentId:        trigger.DeploymentId,
+		ApplicationName:     trigger.ApplicationName,
+		DeploymentGroupName: trigger.DeploymentGroupName,
+		Status:              notificationStatus(trigger.Status),
+	}
+	if trigger.InstanceId != "" {
+		n.InstanceId = instanceIdFromArn(trigger.InstanceId)
+		n.Status = notificationStatus(trigger.InstanceStatus)
+	}
+	return validNotification(n)
+}
+
+func validNotification(n *Notification) (*Notification, error) {
+	if n.DeploymentId == "" || n.Status == "" {
+		return nil, errors.New("not a CodeDeploy notification")
+	}
+	return n, nil
+}
+
+// notificationStatus converts the states used by notifications to the
+// statuses returned by the api
+func notificationStatus(state string) string {
+	switch strings.ToUpper(strings.Replace(state, "_", "", -1)) {
+	case "CREATED":
+		return "Created"
+	case "QUEUED":
+		return "Queued"
+	case "START", "INPROGRESS":
+		return "InProgress"
+	case "SUCCESS", "SUCCEEDED":
+		return "Succeeded"
+	case "FAILURE", "FAILED":
+		return "Failed"
+	case "STOP", "STOPPED":
+		return "Stopped"
+	case "READY":
+		return "Ready"
+	case "PENDING":
+		return "Pending"
+	case "SKIPPED":
+		return "Skipped"
+	default:
+		return ""
+	}
+}
+
+// finishedRank is the rank of the statuses deployments and instances end in
+const finishedRank = 4
+
+// statusRank orders the statuses of deployments and instances by how far
+// along they are
+func statusRank(status string) int {
+	switch status {
+	case "Created", "Queued", "Pending":
+		return 1
+	case "Ready", "Baking":
+		return 2
+	case "InProgress":
+		return 3
+	case "Succeeded", "Failed", "Stopped", "Skipped":
+		return finishedRank
+	default:
+		return 0
+	}
+}
+
+// staleStatus is true for a status that would not move a deployment or
+// instance forward from its current status, which only a late or repeated
+// notification would do. Nothing moves out of a finished status.
+func staleStatus(current, status string) bool {
+	if status == current || statusRank(current) == finishedRank {
+		return true
+	}
+	return statusRank(status) < statusRank(current)
+}
+
+// NotificationConsumer applies notifications from a queue to the renderer,
+// so changes show up without waiting for the poller, which is left to
+// reconcile what notifications don't carry
+type NotificationConsumer struct {
+	queue  Queue
+	poller *Poller
+	logger *log.Logger
+	wait   time.Duration
+}
+
+func NewNotificationConsumer(queue Queue, poller *Poller, logger *log.Logger) *NotificationConsumer {
+	return &NotificationConsumer{
+		queue,
+		poller,
+		logger,
+		0,
+	}
+}
+
+// Start consumes the queue in the background until checker quits.
+// Receiving waits for messages, so there is only a wait between receives
+// after errors or receiving nothing.
+func (c *NotificationConsumer) Start(checker *Checker) {
+	checker.Schedule(func() time.Duration {
+		return c.wait
+	}, c.Receive)
+}
+
+// Receive handles the messages received from the queue in one wait
+func (c *NotificationConsumer) Receive() {
+	bodies, handles, err := c.queue.Receive()
+	if err != nil {
+		c.logger.Printf("Error receiving notifications: %s\n", err)
+		c.wait = receiveErrorWait
+		return
+	}
+
+	c.wait = 0
+	if len(bodies) == 0 {
+		c.wait = receiveEmptyWait
+	}
+
+	for i, body := range bodies {
+		err = c.Handle(body)
+		if err != nil {
+			c.logger.Printf("Error handling notification: %s %s\n", err, body)
+		}
+
+		// unusable messages are deleted too, they would only come back
+		err = c.queue.Delete(handles[i])
+		if err != nil {
+			c.logger.Printf("Error deleting notification: %s\n", err)
+		}
+	}
+}
+
+// Handle applies a single notification
+func (c *NotificationConsumer) Handle(body string) error {
+	n, err := ParseNotification(body)
+	if err != nil {
+		return err
+	}
+
+	renderer := c.poller.renderer
+
+	if n.InstanceId == "" {
+		// finished deployments are fetched once more, for their complete
+		// time and error information
+		if IsDeploymentStatusDone(n.Status) && renderer.HasDeployment(n.DeploymentId) {
+			c.poller.Refresh(n.DeploymentId)
+			return nil
+		}
+
+		if renderer.SetDeploymentStatus(n.DeploymentId, n.Status) {
+			return nil
+		}
+
+		// start watching new deployments the poller would have found
+		if c.poller.Matches(n.ApplicationName, n.DeploymentGroupName) {
+			c.poller.Add(n.DeploymentId)
+			c.poller.Refresh(n.DeploymentId)
+		}
+		return nil
+	}
+
+	if !renderer.HasDeployment(n.DeploymentId) {
+		return nil
+	}
+
+	if !renderer.SetInstanceStatus(n.DeploymentId, n.InstanceId, n.Status) {
+		// pick up instances that joined the deployment
+		c.poller.Refresh(n.DeploymentId)
+	}
+
+	// notifications don't carry lifecycle events or their diagnostics,
+	// fetch them once the instance is done
+	if IsDeploymentStatusDone(n.Status) || n.Status == "Skipped" {
+		c.poller.RefreshInstance(n.DeploymentId, n.InstanceId)
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package watch
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	deploymentEventBody = `{"source":"aws.codedeploy","detail-type":"CodeDeploy Deployment State-change Notification","detail":{"deploymentId":"d-1","application":"web","deploymentGroup":"prod","state":"START"}}`
+	instanceEventBody   = `{"source":"aws.codedeploy","detail-type":"CodeDeploy Instance State-change Notification","detail":{"deploymentId":"d-1","application":"web","deploymentGroup":"prod","instanceId":"arn:aws:ec2:us-east-1:123:instance/i-1","state":"FAILURE"}}`
+	triggerEnvelopeBody = `{"Type":"Notification","Message":"{\"deploymentId\":\"d-2\",\"applicationName\":\"web\",\"deploymentGroupName\":\"prod\",\"status\":\"SUCCEEDED\"}"}`
+)
+
+func TestParseNotification(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		n    *Notification
+	}{
+		{deploymentEventBody, &Notification{"d-1", "web", "prod", "", "InProgress"}},
+		{instanceEventBody, &Notification{"d-1", "web", "prod", "i-1", "Failed"}},
+		{triggerEnvelopeBody, &Notification{"d-2", "web", "prod", "", "Succeeded"}},
+		{`{"deploymentId":"d-3","instanceId":"i-3","instanceStatus":"Skipped","status":"IN_PROGRESS"}`, &Notification{"d-3", "", "", "i-3", "Skipped"}},
+		{`{"source":"aws.ec2","detail":{}}`, nil},
+		{`not json`, nil},
+	} {
+		n, err := ParseNotification(tt.body)
+		if tt.n == nil {
+			if err == nil {
+				t.Errorf("ParseNotification(%s) => %+v, want an error", tt.body, n)
+			}
+			continue
+		}
+		if err != nil || *n != *tt.n {
+			t.Errorf("ParseNotification(%s) => %+v, %v, want %+v", tt.body, n, err, tt.n)
+		}
+	}
+}
+
+func TestNotificationConsumerHandle(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(&fakeAws{}, renderer, NewChecker(logger), logger, "web", []string{"prod"}, 0)
+	consumer := NewNotificationConsumer(nil, poller, logger)
+
+	// instances of unknown deployments are ignored
+	if err := consumer.Handle(instanceEventBody); err != nil || renderer.HasDeployment("d-1") {
+		t.Fatalf("Handle(instance of unknown deployment) => %v", err)
+	}
+
+	if err := consumer.Handle(deploymentEventBody); err != nil || !renderer.HasDeployment("d-1") {
+		t.Fatalf("Handle(new deployment) did not add it: %v", err)
+	}
+
+	if err := consumer.Handle(`{"deploymentId":"d-9","applicationName":"api","deploymentGroupName":"prod","status":"CREATED"}`); err != nil || renderer.HasDeployment("d-9") {
+		t.Errorf("Handle(deployment of another application) added it: %v", err)
+	}
+
+	if err := consumer.Handle(`{"deploymentId":"d-1","instanceId":"i-1","instanceStatus":"PENDING","status":"IN_PROGRESS"}`); err != nil {
+		t.Fatalf("Handle(instance) => %v", err)
+	}
+	if status := aws.StringValue(renderer.InstanceSummaries["i-1"].Status); status != "Pending" {
+		t.Errorf("instance status => %s, want Pending", status)
+	}
+}
+
+func TestNotificationConsumerOutOfOrder(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(&fakeAws{}, renderer, NewChecker(logger), logger, "web", []string{"prod"}, 0)
+	consumer := NewNotificationConsumer(nil, poller, logger)
+
+	poller.Add("d-1")
+	poller.Refresh("d-1")
+	renderer.SetDeploymentStatus("d-1", "Succeeded")
+	renderer.SetInstanceStatus("d-1", "i-1", "Succeeded")
+	transitions := len(renderer.Transitions)
+
+	for _, body := range []string{
+		deploymentEventBody,
+		`{"deploymentId":"d-1","instanceId":"i-1","instanceStatus":"PENDING","status":"IN_PROGRESS"}`,
+		`{"deploymentId":"d-1","instanceId":"i-1","instanceStatus":"IN_PROGRESS","status":"IN_PROGRESS"}`,
+	} {
+		if err := consumer.Handle(body); err != nil {
+			t.Fatalf("Handle(%s) => %v", body, err)
+		}
+	}
+
+	if status := aws.StringValue(renderer.GetDeployment("d-1").Status); status != "Succeeded" {
+		t.Errorf("deployment status => %s, want Succeeded", status)
+	}
+	if status := aws.StringValue(renderer.InstanceSummaries["i-1"].Status); status != "Succeeded" {
+		t.Errorf("instance status => %s, want Succeeded", status)
+	}
+	if len(renderer.Transitions) != transitions {
+		t.Errorf("late notifications added %d transitions", len(renderer.Transitions)-transitions)
+	}
+}
+
+func TestNotificationConsumerRedeploy(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(&fakeAws{}, renderer, NewChecker(logger), logger, "web", []string{"prod"}, 0)
+	consumer := NewNotificationConsumer(nil, poller, logger)
+
+	poller.Add("d-1")
+	poller.Refresh("d-1")
+	renderer.SetDeploymentStatus("d-1", "Succeeded")
+	renderer.SetInstanceStatus("d-1", "i-1", "Succeeded")
+
+	// the same instance in a later deployment starts over
+	poller.Add("d-2")
+	poller.Refresh("d-2")
+	if err := consumer.Handle(`{"deploymentId":"d-2","instanceId":"i-1","instanceStatus":"IN_PROGRESS","status":"IN_PROGRESS"}`); err != nil {
+		t.Fatalf("Handle(instance of d-2) => %v", err)
+	}
+
+	summary := renderer.InstanceSummaries["i-1"]
+	if aws.StringValue(summary.DeploymentId) != "d-2" || aws.StringValue(summary.Status) != "InProgress" {
+		t.Errorf("instance => %s %s, want d-2 InProgress", aws.StringValue(summary.DeploymentId), aws.StringValue(summary.Status))
+	}
+}
+
+func TestStaleStatus(t *testing.T) {
+	for _, tt := range []struct {
+		current string
+		status  string
+		r       bool
+	}{
+		{"", "Pending", false},
+		{"Pending", "InProgress", false},
+		{"InProgress", "Failed", false},
+		{"InProgress", "Pending", true},
+		{"InProgress", "InProgress", true},
+		{"Succeeded", "InProgress", true},
+		{"Failed", "Succeeded", true},
+	} {
+		if r := staleStatus(tt.current, tt.status); r != tt.r {
+			t.Errorf("staleStatus(%s, %s) => %t, want %t", tt.current, tt.status, r, tt.r)
+		}
+	}
+}
+
+// memoryQueue is an in-memory Queue, whose handles are message indexes
+type memoryQueue struct {
+	bodies  []string
+	deleted []string
+	mu      sync.Mutex
+}
+
+func (q *memoryQueue) Receive() ([]string, []string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	bodies := q.bodies
+	handles := []string{}
+	for i := range bodies {
+		handles = append(handles, fmt.Sprintf("%d", i))
+	}
+	q.bodies = []string{}
+	return bodies, handles, nil
+}
+
+func (q *memoryQueue) Delete(handle string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deleted = append(q.deleted, handle)
+	return nil
+}
+
+func TestNotificationConsumerReceive(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(&fakeAws{}, renderer, NewChecker(logger), logger, "web", []string{"prod"}, 0)
+	queue := &memoryQueue{bodies: []string{deploymentEventBody, "not json", instanceEventBody}}
+	consumer := NewNotificationConsumer(queue, poller, logger)
+
+	consumer.Receive()
+
+	if !renderer.HasDeployment("d-1") {
+		t.Errorf("Receive() did not handle the deployment notification")
+	}
+	if expected := []string{"0", "1", "2"}; !reflect.DeepEqual(queue.deleted, expected) {
+		t.Errorf("Receive() deleted %v, want %v", queue.deleted, expected)
+	}
+	if consumer.wait != 0 {
+		t.Errorf("Receive() with messages waits %s, want 0", consumer.wait)
+	}
+
+	// an empty receive must not turn into a busy loop
+	consumer.Receive()
+	if consumer.wait != receiveEmptyWait {
+		t.Errorf("Receive() without messages waits %s, want %s", consumer.wait, receiveEmptyWait)
+	}
+}
+
+// TestSqsQueue receives from and deletes on a local SQS-compatible server
+func TestSqsQueue(t *testing.T) {
+	var (
+		deleted []string
+		mu      sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "ReceiveMessage":
+			sum := md5.Sum([]byte(deploymentEventBody))
+			var body bytes.Buffer
+			xml.EscapeText(&body, []byte(deploymentEventBody))
+			fmt.Fprintf(w, `<ReceiveMessageResponse><ReceiveMessageResult><Message><MessageId>m-1</MessageId>`+
+				`<ReceiptHandle>handle-1</ReceiptHandle><MD5OfBody>%s</MD5OfBody><Body>%s</Body></Message>`+
+				`</ReceiveMessageResult><ResponseMetadata><RequestId>r-1</RequestId></ResponseMetadata></ReceiveMessageResponse>`,
+				hex.EncodeToString(sum[:]), body.String())
+		case "DeleteMessage":
+			mu.Lock()
+			deleted = append(deleted, r.Form.Get("ReceiptHandle"))
+			mu.Unlock()
+			fmt.Fprint(w, `<DeleteMessageResponse><ResponseMetadata><RequestId>r-2</RequestId></ResponseMetadata></DeleteMessageResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	for key, value := range map[string]string{"AWS_REGION": "us-east-1", "AWS_ACCESS_KEY_ID": "test", "AWS_SECRET_ACCESS_KEY": "test"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	queue := NewSqsQueue(server.URL+"/123/deploywatch", server.URL)
+	bodies, handles, err := queue.Receive()
+	if err != nil {
+		t.Fatalf("Receive() => %s", err)
+	}
+	if !reflect.DeepEqual(bodies, []string{deploymentEventBody}) || !reflect.DeepEqual(handles, []string{"handle-1"}) {
+		t.Errorf("Receive() => %v %v", bodies, handles)
+	}
+
+	if err := queue.Delete("handle-1"); err != nil {
+		t.Fatalf("Delete() => %s", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"handle-1"}) {
+		t.Errorf("Delete() deleted %v, want [handle-1]", deleted)
+	}
+}
@@ -0,0 +1,253 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// PipelineAction is the state of an action of a pipeline execution
+type PipelineAction struct {
+	Name       string `json:"name"`
+	Provider   string `json:"provider"`
+	Status     string `json:"status,omitempty"`
+	ExternalId string `json:"externalId,omitempty"`
+	Summary    string `json:"summary,omitempty"`
+}
+
+// DeploymentId is the CodeDeploy deployment started by a Deploy action,
+// empty for other actions
+func (a *PipelineAction) DeploymentId() string {
+	if a.Provider != "CodeDeploy" || !deploymentIdRegexp.MatchString(a.ExternalId) {
+		return ""
+	}
+	return a.ExternalId
+}
+
+// PipelineStage is the state of a stage of a pipeline execution, Status is
+// empty while the execution has not reached the stage, and Superseded once
+// a newer execution has run the stage since
+type PipelineStage struct {
+	Name    string            `json:"name"`
+	Status  string            `json:"status,omitempty"`
+	Actions []*PipelineAction `json:"actions"`
+}
+
+// Pipeline is the progress of a single execution of a pipeline
+type Pipeline struct {
+	Name        string           `json:"name"`
+	ExecutionId string           `json:"executionId"`
+	Status      string           `json:"status"`
+	Stages      []*PipelineStage `json:"stages"`
+}
+
+// NewPipeline combines the declaration of a pipeline with its state. The
+// state only has the latest execution of each stage. Stages run in order, so
+// a stage showing another execution was run by a newer one if the execution
+// has reached a later stage or succeeded, and not reached yet otherwise.
+func NewPipeline(declaration *codepipeline.PipelineDeclaration, state *codepipeline.GetPipelineStateOutput, execution *codepipeline.PipelineExecution) *Pipeline {
+	executionId := aws.StringValue(execution.PipelineExecutionId)
+
+	stageStates := map[string]*codepipeline.StageState{}
+	for _, stageState := range state.StageStates {
+		stageStates[aws.StringValue(stageState.StageName)] = stageState
+	}
+
+	pipeline := &Pipeline{
+		Name:        aws.StringValue(declaration.Name),
+		ExecutionId: executionId,
+		Status:      aws.StringValue(execution.Status),
+		Stages:      []*PipelineStage{},
+	}
+
+	for _, stageDeclaration := range declaration.Stages {
+		stage := &PipelineStage{Name: aws.StringValue(stageDeclaration.Name), Actions: []*PipelineAction{}}
+
+		actionStates := map[string]*codepipeline.ActionExecution{}
+		stageState, ok := stageStates[stage.Name]
+		if ok && stageState.LatestExecution != nil && aws.StringValue(stageState.LatestExecution.PipelineExecutionId) == executionId {
+			stage.Status = aws.StringValue(stageState.LatestExecution.Status)
+			for _, actionState := range stageState.ActionStates {
+				if actionState.LatestExecution != nil {
+					actionStates[aws.StringValue(actionState.ActionName)] = actionState.LatestExecution
+				}
+			}
+		}
+
+		for _, actionDeclaration := range stageDeclaration.Actions {
+			action := &PipelineAction{Name: aws.StringValue(actionDeclaration.Name)}
+			if actionDeclaration.ActionTypeId != nil {
+				action.Provider = aws.StringValue(actionDeclaration.ActionTypeId.Provider)
+			}
+			if actionExecution, ok := actionStates[action.Name]; ok {
+				action.Status = aws.StringValue(actionExecution.Status)
+				action.ExternalId = aws.StringValue(actionExecution.ExternalExecutionId)
+				action.Summary = aws.StringValue(actionExecution.Summary)
+			}
+			stage.Actions = append(stage.Actions, action)
+		}
+
+		pipeline.Stages = append(pipeline.Stages, stage)
+	}
+
+	reached := -1
+	for i, stage := range pipeline.Stages {
+		if stage.Status != "" {
+			reached = i
+		}
+	}
+	for i, stage := range pipeline.Stages {
+		if stage.Status == "" && (i < reached || pipeline.Status == "Succeeded") {
+			stage.Status = "Superseded"
+		}
+	}
+
+	return pipeline
+}
+
+// DeploymentIds lists the CodeDeploy deployments started by the execution
+func (p *Pipeline) DeploymentIds() []string {
+	deploymentIds := []string{}
+	for _, stage := range p.Stages {
+		for _, action := range stage.Actions {
+			if deploymentId := action.DeploymentId(); deploymentId != "" {
+				deploymentIds = append(deploymentIds, deploymentId)
+			}
+		}
+	}
+	return deploymentIds
+}
+
+// IsPipelineExecutionDone is true once an execution will not change anymore
+func IsPipelineExecutionDone(status string) bool {
+	switch status {
+	case "Succeeded", "Failed", "Stopped", "Superseded":
+		return true
+	default:
+		return false
+	}
+}
+
+// PipelineLines prints the progress of each stage of a pipeline execution
+// and of the actions of the stages it shows the state of
+func PipelineLines(p *Pipeline) string {
+	if p == nil {
+		return ""
+	}
+
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("%s %s %s\n", StrColor(p.Name, "cyan"), p.ExecutionId, StatusStr(p.Status)))
+	for _, stage := range p.Stages {
+		if stage.Status == "" {
+			b.WriteString(fmt.Sprintf("  %s %s\n", stage.Name, StrColor("not reached", "yellow")))
+			continue
+		}
+		if stage.Status == "Superseded" {
+			b.WriteString(fmt.Sprintf("  %s %s\n", stage.Name, StrColor("superseded", "white")))
+			continue
+		}
+
+		b.WriteString(fmt.Sprintf("  %s %s\n", stage.Name, StatusStr(stage.Status)))
+		for _, action := range stage.Actions {
+			b.WriteString(fmt.Sprintf("    %s (%s) %s", action.Name, action.Provider, StatusStr(action.Status)))
+			if action.ExternalId != "" {
+				b.WriteString(" " + action.ExternalId)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// PipelineFollower follows an execution of a pipeline, showing its
+// progress and watching the deployments its Deploy actions start
+type PipelineFollower struct {
+	// Interval is how often the pipeline state is fetched
+	Interval time.Duration
+
+	aws         Aws
+	poller      *Poller
+	logger      *log.Logger
+	name        string
+	executionId string
+	declaration *codepipeline.PipelineDeclaration
+	done        bool
+}
+
+// NewPipelineFollower follows an execution of a pipeline, its latest
+// execution if executionId is empty
+func NewPipelineFollower(aws Aws, poller *Poller, logger *log.Logger, name, executionId string) *PipelineFollower {
+	return &PipelineFollower{
+		5 * time.Second,
+		aws,
+		poller,
+		logger,
+		name,
+		executionId,
+		nil,
+		false,
+	}
+}
+
+// Start follows the execution in the background until checker quits
+func (f *PipelineFollower) Start(checker *Checker) {
+	checker.Schedule(func() time.Duration {
+		return f.Interval
+	}, f.Check)
+}
+
+// Check fetches the state of the execution until it is done, adding the
+// deployments it started to the poller
+func (f *PipelineFollower) Check() {
+	if f.done {
+		return
+	}
+
+	pipeline, err := f.Fetch()
+	if err != nil {
+		f.logger.Printf("Error fetching pipeline: %s %s\n", f.name, err)
+		return
+	}
+
+	f.poller.renderer.SetPipeline(pipeline)
+	for _, deploymentId := range pipeline.DeploymentIds() {
+		f.poller.Add(deploymentId)
+	}
+
+	f.done = IsPipelineExecutionDone(pipeline.Status)
+}
+
+// Fetch returns the current progress of the execution
+func (f *PipelineFollower) Fetch() (*Pipeline, error) {
+	var err error
+
+	if f.executionId == "" {
+		f.executionId, err = f.aws.LatestPipelineExecution(f.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.declaration == nil {
+		f.declaration, err = f.aws.GetPipeline(f.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	execution, err := f.aws.GetPipelineExecution(f.name, f.executionId)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := f.aws.GetPipelineState(f.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPipeline(f.declaration, state, execution), nil
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+func TestNewPipeline(t *testing.T) {
+	action := func(name, provider string) *codepipeline.ActionDeclaration {
+		return &codepipeline.ActionDeclaration{Name: aws.String(name), ActionTypeId: &codepipeline.ActionTypeId{Provider: aws.String(provider)}}
+	}
+	declaration := &codepipeline.PipelineDeclaration{
+		Name: aws.String("web"),
+		Stages: []*codepipeline.StageDeclaration{
+			{Name: aws.String("Source"), Actions: []*codepipeline.ActionDeclaration{action("Checkout", "CodeCommit")}},
+			{Name: aws.String("Build"), Actions: []*codepipeline.ActionDeclaration{action("Build", "CodeBuild")}},
+			{Name: aws.String("Staging"), Actions: []*codepipeline.ActionDeclaration{action("Deploy", "CodeDeploy")}},
+			{Name: aws.String("Production"), Actions: []*codepipeline.ActionDeclaration{action("Deploy", "CodeDeploy")}},
+		},
+	}
+
+	stage := func(name, executionId, status, actionName, externalId string) *codepipeline.StageState {
+		return &codepipeline.StageState{
+			StageName:       aws.String(name),
+			LatestExecution: &codepipeline.StageExecution{PipelineExecutionId: aws.String(executionId), Status: aws.String(status)},
+			ActionStates: []*codepipeline.ActionState{{
+				ActionName:      aws.String(actionName),
+				LatestExecution: &codepipeline.ActionExecution{Status: aws.String(status), ExternalExecutionId: aws.String(externalId)},
+			}},
+		}
+	}
+	state := &codepipeline.GetPipelineStateOutput{
+		StageStates: []*codepipeline.StageState{
+			// since run by a newer execution
+			stage("Source", "exec-3", "InProgress", "Checkout", "def456"),
+			stage("Build", "exec-2", "Succeeded", "Build", "b-1"),
+			stage("Staging", "exec-2", "InProgress", "Deploy", "d-STAGING"),
+			// still showing the previous execution
+			stage("Production", "exec-1", "Succeeded", "Deploy", "d-PRODUCTION"),
+		},
+	}
+	execution := &codepipeline.PipelineExecution{PipelineExecutionId: aws.String("exec-2"), Status: aws.String("InProgress")}
+
+	pipeline := NewPipeline(declaration, state, execution)
+
+	statuses := []string{}
+	for _, stage := range pipeline.Stages {
+		statuses = append(statuses, stage.Name+" "+stage.Status)
+	}
+	if expected := []string{"Source Superseded", "Build Succeeded", "Staging InProgress", "Production "}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("NewPipeline() stages => %v, want %v", statuses, expected)
+	}
+
+	if deploymentIds := pipeline.DeploymentIds(); !reflect.DeepEqual(deploymentIds, []string{"d-STAGING"}) {
+		t.Errorf("DeploymentIds() => %v, want [d-STAGING]", deploymentIds)
+	}
+
+	lines := PipelineLines(pipeline)
+	if !strings.Contains(lines, "Deploy (CodeDeploy) [InProgress](fg-blue) d-STAGING") || !strings.Contains(lines, "Production [not reached](fg-yellow)") ||
+		!strings.Contains(lines, "Source [superseded](fg-white)") || strings.Contains(lines, "def456") {
+		t.Errorf("PipelineLines() => %s", lines)
+	}
+
+	// a succeeded execution ran every stage
+	execution = &codepipeline.PipelineExecution{PipelineExecutionId: aws.String("exec-1"), Status: aws.String("Succeeded")}
+	for _, stage := range NewPipeline(declaration, state, execution).Stages {
+		want := "Superseded"
+		if stage.Name == "Production" {
+			want = "Succeeded"
+		}
+		if stage.Status != want {
+			t.Errorf("NewPipeline(exec-1) stage %s => %s, want %s", stage.Name, stage.Status, want)
+		}
+	}
+}
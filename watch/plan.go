@@ -0,0 +1,233 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// defaultDeploymentConfig is what CodeDeploy uses for groups without one
+const defaultDeploymentConfig = "CodeDeployDefault.OneAtATime"
+
+// PlanInstance is an instance a deployment to a group would deploy to,
+// Source is the tag filter or auto scaling group it was found by
+type PlanInstance struct {
+	InstanceId string `json:"instanceId"`
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+}
+
+// Plan is how CodeDeploy would roll out a deployment to a group now
+type Plan struct {
+	ApplicationName      string          `json:"applicationName"`
+	DeploymentGroupName  string          `json:"deploymentGroupName"`
+	DeploymentConfigName string          `json:"deploymentConfigName"`
+	Instances            []*PlanInstance `json:"instances"`
+	MinimumHealthy       int             `json:"minimumHealthy"`
+	WaveSize             int             `json:"waveSize"`
+	Waves                int             `json:"waves"`
+	Eta                  *int            `json:"eta,omitempty"`
+	HistoryDeployments   int             `json:"historyDeployments"`
+}
+
+// NewPlan splits instances into the waves a deployment using config
+// would deploy them in, estimating its duration from the group's history
+func NewPlan(applicationName, deploymentGroupName, configName string, config *codedeploy.DeploymentConfigInfo, instances []*PlanInstance, history *GroupHistory) *Plan {
+	total := len(instances)
+	waveSize := MaxConcurrentInstances(config, total)
+
+	plan := &Plan{
+		ApplicationName:      applicationName,
+		DeploymentGroupName:  deploymentGroupName,
+		DeploymentConfigName: configName,
+		Instances:            instances,
+		MinimumHealthy:       MinimumHealthyInstances(config, total),
+		WaveSize:             waveSize,
+	}
+	if waveSize > 0 {
+		plan.Waves = (total + waveSize - 1) / waveSize
+	}
+	if history != nil {
+		plan.HistoryDeployments = history.Deployments
+	}
+
+	// every instance is pending
+	estimator := NewEtaEstimator([]*codedeploy.InstanceSummary{}, history)
+	plan.Eta = etaPtr(estimator.Deployment(make([]*codedeploy.InstanceSummary, total), waveSize))
+
+	return plan
+}
+
+// MakePlan plans a deployment to a group using the named deployment
+// config, the group's own if empty, with durations from the successful
+// deployments of the group within history
+func MakePlan(a Aws, applicationName, deploymentGroupName, configName string, history time.Duration, maxDeployments int) (*Plan, error) {
+	group, err := a.GetDeploymentGroup(applicationName, deploymentGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if configName == "" {
+		configName = aws.StringValue(group.DeploymentConfigName)
+	}
+	if configName == "" {
+		configName = defaultDeploymentConfig
+	}
+
+	config, err := a.GetDeploymentConfig(configName)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := GroupInstances(a, group)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	h, err := AnalyzeHistory(a, applicationName, deploymentGroupName, end.Add(-history), end, maxDeployments)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPlan(applicationName, deploymentGroupName, configName, config, instances, h), nil
+}
+
+// GroupInstances lists the running instances matching any of the EC2 tag
+// filters of a deployment group, and the in service instances of its
+// auto scaling groups
+func GroupInstances(a Aws, group *codedeploy.DeploymentGroupInfo) ([]*PlanInstance, error) {
+	found := map[string]*PlanInstance{}
+
+	for _, tagFilter := range group.Ec2TagFilters {
+		instances, err := a.FilterInstances(ec2TagFilters(tagFilter))
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			instanceId := aws.StringValue(instance.InstanceId)
+			if _, ok := found[instanceId]; !ok {
+				found[instanceId] = &PlanInstance{instanceId, InstanceName(instance), "tag " + tagFilterStr(tagFilter)}
+			}
+		}
+	}
+
+	names := []string{}
+	for _, scalingGroup := range group.AutoScalingGroups {
+		names = append(names, aws.StringValue(scalingGroup.Name))
+	}
+	if len(names) > 0 {
+		scalingGroups, err := a.DescribeAutoScalingGroups(names)
+		if err != nil {
+			return nil, err
+		}
+
+		instanceIds := []string{}
+		for _, scalingGroup := range scalingGroups {
+			for _, instance := range scalingGroup.Instances {
+				instanceId := aws.StringValue(instance.InstanceId)
+				if aws.StringValue(instance.LifecycleState) != "InService" {
+					continue
+				}
+				if _, ok := found[instanceId]; !ok {
+					found[instanceId] = &PlanInstance{instanceId, "", "asg " + aws.StringValue(scalingGroup.AutoScalingGroupName)}
+					instanceIds = append(instanceIds, instanceId)
+				}
+			}
+		}
+
+		if len(instanceIds) > 0 {
+			instances, err := a.DescribeInstances(instanceIds)
+			if err != nil {
+				return nil, err
+			}
+			for _, instance := range instances {
+				found[aws.StringValue(instance.InstanceId)].Name = InstanceName(instance)
+			}
+		}
+	}
+
+	result := []*PlanInstance{}
+	for _, instance := range found {
+		result = append(result, instance)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].InstanceId < result[j].InstanceId
+	})
+
+	return result, nil
+}
+
+// ec2TagFilters converts a CodeDeploy tag filter to the EC2 filters of the
+// running instances it matches
+func ec2TagFilters(tagFilter *codedeploy.EC2TagFilter) []*ec2.Filter {
+	key := aws.StringValue(tagFilter.Key)
+	value := aws.StringValue(tagFilter.Value)
+
+	filters := []*ec2.Filter{
+		{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})},
+	}
+
+	switch aws.StringValue(tagFilter.Type) {
+	case codedeploy.EC2TagFilterTypeKeyOnly:
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{key})})
+	case codedeploy.EC2TagFilterTypeValueOnly:
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag-value"), Values: aws.StringSlice([]string{value})})
+	default:
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag:" + key), Values: aws.StringSlice([]string{value})})
+	}
+
+	return filters
+}
+
+func tagFilterStr(tagFilter *codedeploy.EC2TagFilter) string {
+	switch aws.StringValue(tagFilter.Type) {
+	case codedeploy.EC2TagFilterTypeKeyOnly:
+		return aws.StringValue(tagFilter.Key)
+	case codedeploy.EC2TagFilterTypeValueOnly:
+		return "=" + aws.StringValue(tagFilter.Value)
+	default:
+		return aws.StringValue(tagFilter.Key) + "=" + aws.StringValue(tagFilter.Value)
+	}
+}
+
+func WritePlanTable(w io.Writer, p *Plan) error {
+	fmt.Fprintf(w, "%s-%s with %s: %d instances, %d must stay healthy\n",
+		p.ApplicationName, p.DeploymentGroupName, p.DeploymentConfigName, len(p.Instances), p.MinimumHealthy)
+	fmt.Fprintf(w, "%d waves of up to %d instances", p.Waves, p.WaveSize)
+	if p.Eta != nil {
+		fmt.Fprintf(w, ", about %s from %d deployments", strings.TrimSpace(DurationStr(*p.Eta)), p.HistoryDeployments)
+	} else {
+		fmt.Fprintf(w, ", no history to estimate the duration from")
+	}
+	fmt.Fprintf(w, "\n\n")
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "WAVE\tINSTANCE\tNAME\tSOURCE")
+	for i, instance := range p.Instances {
+		wave := 1
+		if p.WaveSize > 0 {
+			wave = i/p.WaveSize + 1
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", wave, instance.InstanceId, instance.Name, instance.Source)
+	}
+
+	return tw.Flush()
+}
+
+func WritePlanJson(w io.Writer, p *Plan) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -0,0 +1,87 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// fakeGroupAws finds i-1 and i-2 by tag, and i-2 and i-3 in service in an
+// auto scaling group
+type fakeGroupAws struct {
+	fakeAws
+}
+
+func (f *fakeGroupAws) FilterInstances([]*ec2.Filter) ([]*ec2.Instance, error) {
+	return []*ec2.Instance{{InstanceId: aws.String("i-1")}, {InstanceId: aws.String("i-2")}}, nil
+}
+
+func (f *fakeGroupAws) DescribeAutoScalingGroups([]string) ([]*autoscaling.Group, error) {
+	return []*autoscaling.Group{{
+		AutoScalingGroupName: aws.String("web-asg"),
+		Instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("i-2"), LifecycleState: aws.String("InService")},
+			{InstanceId: aws.String("i-3"), LifecycleState: aws.String("InService")},
+			{InstanceId: aws.String("i-4"), LifecycleState: aws.String("Terminating")},
+		},
+	}}, nil
+}
+
+func TestGroupInstances(t *testing.T) {
+	group := &codedeploy.DeploymentGroupInfo{
+		Ec2TagFilters:     []*codedeploy.EC2TagFilter{{Key: aws.String("role"), Value: aws.String("web"), Type: aws.String("KEY_AND_VALUE")}},
+		AutoScalingGroups: []*codedeploy.AutoScalingGroup{{Name: aws.String("web-asg")}},
+	}
+
+	instances, err := GroupInstances(&fakeGroupAws{}, group)
+	if err != nil {
+		t.Fatalf("GroupInstances() => %s", err)
+	}
+
+	sources := []string{}
+	for _, instance := range instances {
+		sources = append(sources, instance.InstanceId+" "+instance.Source)
+	}
+	if expected := []string{"i-1 tag role=web", "i-2 tag role=web", "i-3 asg web-asg"}; !reflect.DeepEqual(sources, expected) {
+		t.Errorf("GroupInstances() => %v, want %v", sources, expected)
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	instances := []*PlanInstance{}
+	for _, instanceId := range []string{"i-1", "i-2", "i-3", "i-4", "i-5"} {
+		instances = append(instances, &PlanInstance{InstanceId: instanceId})
+	}
+	history := &GroupHistory{Deployments: 4, Instance: &DurationStats{Name: "Instance", Count: 20, P50: 60}}
+
+	for _, tt := range []struct {
+		config   *codedeploy.DeploymentConfigInfo
+		history  *GroupHistory
+		minimum  int
+		waveSize int
+		waves    int
+		eta      int
+	}{
+		{testDeploymentConfig("FLEET_PERCENT", 50), history, 3, 2, 3, 180},
+		{testDeploymentConfig("MOST_CONCURRENCY", 1), history, 4, 1, 5, 300},
+		{testDeploymentConfig("HOST_COUNT", 0), nil, 0, 5, 1, -1},
+	} {
+		plan := NewPlan("web", "prod", "config", tt.config, instances, tt.history)
+		if plan.MinimumHealthy != tt.minimum || plan.WaveSize != tt.waveSize || plan.Waves != tt.waves {
+			t.Errorf("NewPlan(%v) => %d healthy, %d waves of %d, want %d healthy, %d waves of %d",
+				tt.config, plan.MinimumHealthy, plan.Waves, plan.WaveSize, tt.minimum, tt.waves, tt.waveSize)
+		}
+
+		eta := -1
+		if plan.Eta != nil {
+			eta = *plan.Eta
+		}
+		if eta != tt.eta {
+			t.Errorf("NewPlan(%v) eta => %d, want %d", tt.config, eta, tt.eta)
+		}
+	}
+}
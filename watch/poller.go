@@ -0,0 +1,381 @@
+package watch
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Created | Queued | InProgress | Succeeded | Failed | Stopped | Ready
+var includeOnlyStatuses = []string{"Created", "Queued", "InProgress"}
+
+// Poller runs the loops that periodically discover deployments, keep
+// track of their instances and fetch instance summaries into the
+// renderer. Every output mode shares the same polling loops.
+type Poller struct {
+	// Discover keeps discovering running deployments of every
+	// application when no deployment groups are given
+	Discover bool
+	// Retain is how long finished deployments are kept before they
+	// are forgotten, 0 to keep them forever
+	Retain time.Duration
+	// AutoScaling follows the auto scaling groups targeted by running
+	// deployments, to explain instances they launch or terminate
+	AutoScaling bool
+	// TargetGroups are target groups, by name or arn, whose health is
+	// shown along with the classic load balancers of deployment groups
+	TargetGroups []string
+	// DeploymentInterval is how often deployments are listed and refreshed
+	DeploymentInterval time.Duration
+	// InstanceInterval is how often the instance list is updated and
+	// the output re-rendered
+	InstanceInterval time.Duration
+	// SummaryInterval is how often instance summaries are fetched. It is
+	// shortened while instances are in progress and lengthened while
+	// deployments are waiting.
+	SummaryInterval time.Duration
+	// Jitter randomly varies api polling intervals by up to this fraction,
+	// so that many watchers don't poll in lockstep
+	Jitter float64
+
+	aws            Aws
+	renderer       *Renderer
+	checker        *Checker
+	logger         *log.Logger
+	name           string
+	groups         []string
+	history        time.Duration
+	deploymentIds  *Set
+	checkInstances map[string]*Set
+	doneInstances  map[string]*Set
+	finished       *Set
+	idle           int
+	throttle       *Throttle
+	mu             sync.Mutex
+}
+
+const (
+	// inProgressFactor shortens the summary interval while instances are in progress
+	inProgressFactor = 0.5
+	// maxIdleBackoff caps how many times the summary interval doubles
+	// while deployments are waiting
+	maxIdleBackoff = 2
+)
+
+func NewPoller(aws Aws, renderer *Renderer, checker *Checker, logger *log.Logger, name string, groups []string, history time.Duration) *Poller {
+	return &Poller{
+		false,
+		0,
+		true,
+		[]string{},
+		5 * time.Second,
+		time.Second,
+		10 * time.Second,
+		0.1,
+		aws,
+		renderer,
+		checker,
+		logger,
+		name,
+		groups,
+		history,
+		NewSet(),
+		map[string]*Set{},
+		map[string]*Set{},
+		NewSet(),
+		0,
+		NewThrottle(5.0, 0.025),
+		sync.Mutex{},
+	}
+}
+
+// Add starts watching a deployment by id
+func (p *Poller) Add(deploymentId string) {
+	p.deploymentIds.Add(deploymentId)
+}
+
+// Start begins polling, with changes published on the renderer's bus
+func (p *Poller) Start() {
+	// periodically check for updated deployment information
+	p.checker.Schedule(func() time.Duration {
+		return Jitter(p.DeploymentInterval, p.Jitter)
+	}, p.checkDeployments)
+
+	// periodically update list of instances to check
+	p.checker.Schedule(func() time.Duration {
+		return p.InstanceInterval
+	}, func() {
+		p.checkInstanceList()
+
+		// tick so elapsed times and etas of running events stay live
+		p.renderer.Bus().Publish(&Tick{time.Now()})
+	})
+
+	p.checker.Schedule(p.summaryInterval, p.checkInstanceSummaries)
+}
+
+// summaryInterval adapts the summary interval to what the watched
+// deployments are doing
+func (p *Poller) summaryInterval() time.Duration {
+	interval := p.SummaryInterval
+
+	inProgress, waiting := p.renderer.InstanceActivity()
+	if inProgress > 0 {
+		p.idle = 0
+		interval = time.Duration(float64(interval) * inProgressFactor)
+	} else if waiting > 0 {
+		if p.idle < maxIdleBackoff {
+			p.idle += 1
+		}
+		interval = interval << uint(p.idle)
+	} else {
+		p.idle = 0
+	}
+
+	return Jitter(interval, p.Jitter)
+}
+
+// Jitter randomly varies interval by up to fraction of itself
+func Jitter(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	return interval + time.Duration(float64(interval)*fraction*(2*rand.Float64()-1))
+}
+
+// Throttle returns the throttle applied to instance summary requests
+func (p *Poller) Throttle() *Throttle {
+	return p.throttle
+}
+
+func (p *Poller) checkDeployments() {
+	discover := p.Discover
+	for _, group := range p.groups {
+		if group != "" {
+			discover = false
+			p.listDeployments(p.name, group)
+		}
+	}
+
+	// ListDeployments only accepts an application name along with a
+	// deployment group, so discovery covers every application
+	if discover {
+		p.listDeployments("", "")
+	}
+
+	if p.Retain > 0 {
+		for _, deploymentId := range p.renderer.FinishedDeploymentIds(p.Retain) {
+			p.logger.Printf("Forgetting finished deployment %s\n", deploymentId)
+			p.forget(deploymentId)
+		}
+	}
+
+	for _, deploymentId := range p.deploymentIds.List() {
+		// nothing changes once a finished deployment has been fully fetched
+		if p.finished.Has(deploymentId) {
+			continue
+		}
+
+		p.Refresh(deploymentId)
+	}
+}
+
+// Refresh fetches the current state of a deployment and everything shown
+// along with it
+func (p *Poller) Refresh(deploymentId string) {
+	if !p.renderer.HasDeployment(deploymentId) {
+		p.logger.Printf("Starting to check deployment %s\n", deploymentId)
+	}
+	err := p.renderer.AddDeployment(p.aws, deploymentId)
+	if err != nil {
+		p.logger.Printf("Error getting deployment information: %s\n", err)
+		return
+	}
+
+	err = p.renderer.AddDeploymentConfig(p.aws, deploymentId)
+	if err != nil {
+		p.logger.Printf("Error getting deployment config: %s %s\n", deploymentId, err)
+	}
+
+	err = p.renderer.AddRevision(p.aws, deploymentId)
+	if err != nil {
+		p.logger.Printf("Error getting application revision: %s %s\n", deploymentId, err)
+	}
+
+	if p.AutoScaling {
+		err = p.renderer.AddAutoScaling(p.aws, deploymentId)
+		if err != nil {
+			p.logger.Printf("Error getting auto scaling activity: %s %s\n", deploymentId, err)
+		}
+	}
+
+	err = p.renderer.AddTargetHealth(p.aws, deploymentId, p.TargetGroups)
+	if err != nil {
+		p.logger.Printf("Error getting load balancer health: %s %s\n", deploymentId, err)
+	}
+
+	err = p.renderer.AddAlarms(p.aws, deploymentId)
+	if err != nil {
+		p.logger.Printf("Error getting alarms: %s %s\n", deploymentId, err)
+	}
+
+	if p.history > 0 {
+		err = p.renderer.AddGroupHistory(p.aws, deploymentId, p.history)
+		if err != nil {
+			p.logger.Printf("Error getting deployment group history: %s %s\n", deploymentId, err)
+		}
+	}
+}
+
+// RefreshInstance fetches the summary of a single instance of a deployment
+func (p *Poller) RefreshInstance(deploymentId, instanceId string) {
+	summaries, err := p.aws.BatchGetDeploymentInstances(deploymentId, []string{instanceId})
+	if err != nil {
+		p.logger.Printf("Error getting deployment instance summary %s %s: %s\n", deploymentId, instanceId, err)
+		return
+	}
+
+	p.renderer.BatchUpdate(summaries)
+}
+
+// Matches is true when deployments of a deployment group would be found
+// by the poller, either as one of its groups or by discovery
+func (p *Poller) Matches(application, group string) bool {
+	if application == p.name {
+		for _, g := range p.groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+
+	for _, g := range p.groups {
+		if g != "" {
+			return false
+		}
+	}
+	return p.Discover
+}
+
+func (p *Poller) listDeployments(name, group string) {
+	currentDeployments, err := p.aws.ListDeployments(name, group, includeOnlyStatuses)
+	if err != nil {
+		p.logger.Printf("Error getting deployments: %s %s %s\n", name, group, err)
+		return
+	}
+
+	for _, deploymentId := range currentDeployments {
+		p.deploymentIds.Add(deploymentId)
+	}
+}
+
+// forget stops watching a deployment and drops everything known about it
+func (p *Poller) forget(deploymentId string) {
+	p.deploymentIds.Remove(deploymentId)
+	p.finished.Remove(deploymentId)
+
+	p.mu.Lock()
+	delete(p.checkInstances, deploymentId)
+	delete(p.doneInstances, deploymentId)
+	p.mu.Unlock()
+
+	p.renderer.RemoveDeployment(deploymentId)
+}
+
+// instanceSet returns the set of instances being checked for a deployment
+func (p *Poller) instanceSet(deploymentId string) *Set {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.checkInstances[deploymentId]; !ok {
+		p.checkInstances[deploymentId] = NewSet()
+	}
+	return p.checkInstances[deploymentId]
+}
+
+// doneSet returns the set of instances done with a deployment. An instance
+// may be in several deployments, done with one while still in another.
+func (p *Poller) doneSet(deploymentId string) *Set {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.doneInstances[deploymentId]; !ok {
+		p.doneInstances[deploymentId] = NewSet()
+	}
+	return p.doneInstances[deploymentId]
+}
+
+func (p *Poller) checkInstanceList() {
+	for _, deploymentId := range p.renderer.DeploymentIds() {
+		checkInstances := p.instanceSet(deploymentId)
+		doneInstances := p.doneSet(deploymentId)
+
+		for _, instanceId := range p.renderer.InstanceIds(deploymentId) {
+			if !checkInstances.Has(instanceId) {
+				p.logger.Printf("Starting to check instance %s (%s)\n", instanceId, deploymentId)
+				checkInstances.Add(instanceId)
+			}
+
+			if p.renderer.IsInstanceDone(deploymentId, instanceId) && !doneInstances.Has(instanceId) {
+				p.logger.Printf("Done checking instance %s (%s)\n", instanceId, deploymentId)
+				doneInstances.Add(instanceId)
+			}
+		}
+	}
+
+	for _, straggler := range p.renderer.CheckStragglers() {
+		p.logger.Printf("Instance %s (%s) is %s in %s: %s elapsed, peer median %s\n",
+			straggler.InstanceId, straggler.DeploymentId, straggler.Lag, straggler.LifecycleEventName,
+			DurationStr(straggler.Elapsed), DurationStr(straggler.Median))
+	}
+}
+
+func (p *Poller) checkInstanceSummaries() {
+	for _, deploymentId := range p.renderer.DeploymentIds() {
+		if p.finished.Has(deploymentId) {
+			continue
+		}
+
+		// fetch the summaries of a finished deployment one last time
+		deployment := p.renderer.GetDeployment(deploymentId)
+		done := deployment != nil && IsDeploymentDone(deployment)
+
+		checkInstances := p.instanceSet(deploymentId)
+		if done {
+			// make sure the last fetch covers every instance, even if
+			// the instance list has not caught up yet
+			for _, instanceId := range p.renderer.InstanceIds(deploymentId) {
+				checkInstances.Add(instanceId)
+			}
+		}
+
+		batchCheckInstances := checkInstances.Dif(p.doneSet(deploymentId)).List()
+
+		if len(batchCheckInstances) == 0 {
+			if done {
+				p.logger.Printf("Done checking deployment %s\n", deploymentId)
+				p.finished.Add(deploymentId)
+			}
+			continue
+		}
+
+		summaries, err := p.aws.BatchGetDeploymentInstances(deploymentId, batchCheckInstances)
+		if err != nil {
+			sleep := p.throttle.Throttle()
+			p.logger.Printf("Error getting deployment instance summaries %s: %s\n", deploymentId, err)
+			p.logger.Printf("Instance check throttle increased to %s\n", sleep)
+			time.Sleep(sleep)
+		} else {
+			// touch throttle for sleep decay
+			_ = p.throttle.Sleep()
+
+			if done {
+				p.logger.Printf("Done checking deployment %s\n", deploymentId)
+				p.finished.Add(deploymentId)
+			}
+		}
+
+		p.renderer.BatchUpdate(summaries)
+	}
+}
@@ -0,0 +1,98 @@
+package watch
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		jittered := Jitter(10*time.Second, 0.1)
+		if jittered < 9*time.Second || jittered > 11*time.Second {
+			t.Fatalf("Jitter(10s, 0.1) => %s", jittered)
+		}
+	}
+
+	if Jitter(10*time.Second, 0) != 10*time.Second {
+		t.Errorf("Jitter(10s, 0) should not vary")
+	}
+}
+
+func TestPollerSummaryInterval(t *testing.T) {
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(nil, renderer, NewChecker(log.New(ioutil.Discard, "", 0)), log.New(ioutil.Discard, "", 0), "", []string{}, 0)
+	poller.Jitter = 0
+
+	setStatus := func(deploymentStatus, instanceStatus string) {
+		renderer.Deployments = []*codedeploy.DeploymentInfo{{DeploymentId: aws.String("d-1"), Status: aws.String(deploymentStatus)}}
+		renderer.DeploymentInstanceMap["d-1"] = NewSet()
+		renderer.DeploymentInstanceMap["d-1"].Add("i-1")
+		renderer.InstanceSummaries["i-1"] = &codedeploy.InstanceSummary{Status: aws.String(instanceStatus)}
+	}
+
+	for _, tt := range []struct {
+		deploymentStatus string
+		instanceStatus   string
+		interval         time.Duration
+	}{
+		{"InProgress", "InProgress", 5 * time.Second},
+		{"InProgress", "Pending", 20 * time.Second},
+		{"InProgress", "Pending", 40 * time.Second},
+		{"InProgress", "Pending", 40 * time.Second},
+		{"InProgress", "InProgress", 5 * time.Second},
+		{"Succeeded", "Succeeded", 10 * time.Second},
+	} {
+		setStatus(tt.deploymentStatus, tt.instanceStatus)
+		interval := poller.summaryInterval()
+		if interval != tt.interval {
+			t.Errorf("summaryInterval() with %s/%s => %s, want %s", tt.deploymentStatus, tt.instanceStatus, interval, tt.interval)
+		}
+	}
+}
+
+func TestPollerRedeployedInstance(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	renderer := NewRenderer(false, false, nil)
+	poller := NewPoller(&fakeAws{}, renderer, NewChecker(logger), logger, "", []string{}, 0)
+
+	created := time.Now().Add(-time.Hour)
+	renderer.Deployments = []*codedeploy.DeploymentInfo{
+		{DeploymentId: aws.String("d-1"), Status: aws.String("Succeeded"), CreateTime: &created},
+		{DeploymentId: aws.String("d-2"), Status: aws.String("InProgress"), CreateTime: aws.Time(time.Now())},
+	}
+	for _, deploymentId := range []string{"d-1", "d-2"} {
+		renderer.DeploymentInstanceMap[deploymentId] = NewSet()
+		renderer.DeploymentInstanceMap[deploymentId].Add("i-1")
+	}
+	renderer.InstanceSummaries["i-1"] = &codedeploy.InstanceSummary{
+		DeploymentId: aws.String("d-1"),
+		InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+		Status:       aws.String("Succeeded"),
+	}
+
+	poller.checkInstanceList()
+	if !renderer.IsInstanceDone("d-1", "i-1") || renderer.IsInstanceDone("d-2", "i-1") {
+		t.Errorf("IsInstanceDone() should only count the summary of the instance's own deployment")
+	}
+
+	poller.checkInstanceSummaries()
+	summary := renderer.InstanceSummaries["i-1"]
+	if aws.StringValue(summary.DeploymentId) != "d-2" || aws.StringValue(summary.Status) != "InProgress" {
+		t.Errorf("checkInstanceSummaries() i-1 => %s %s, want d-2 InProgress", aws.StringValue(summary.DeploymentId), aws.StringValue(summary.Status))
+	}
+
+	// a late summary of the earlier deployment does not replace it
+	renderer.Update(&codedeploy.InstanceSummary{
+		DeploymentId: aws.String("d-1"),
+		InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+		Status:       aws.String("Succeeded"),
+	})
+	if summary := renderer.InstanceSummaries["i-1"]; aws.StringValue(summary.DeploymentId) != "d-2" {
+		t.Errorf("Update() with a summary of d-1 => %s, want d-2", aws.StringValue(summary.DeploymentId))
+	}
+}
@@ -0,0 +1,1237 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// maxTransitions is how many past transitions the renderer remembers
+const maxTransitions = 100
+
+type Renderer struct {
+	Deployments           []*codedeploy.DeploymentInfo
+	DeploymentInstanceMap map[string]*Set
+	Instances             map[string]*ec2.Instance
+	InstanceSummaries     map[string]*codedeploy.InstanceSummary
+	DeploymentConfigs     map[string]*codedeploy.DeploymentConfigInfo
+	Revisions             map[string]*codedeploy.GenericRevisionInfo
+	GroupHistories        map[string]*GroupHistory
+	Stragglers            map[string]*Straggler
+	DeploymentGroups      map[string]*codedeploy.DeploymentGroupInfo
+	AutoScaling           map[string]*AutoScaling
+	TargetHealth          map[string][]*TargetHealth
+	Alarms                map[string][]*AlarmState
+	AgentLogs             map[string]*AgentLog
+	Pipeline              *Pipeline
+	Transitions           []*Transition
+	compact               bool
+	hideSuccess           bool
+	detector              *StragglerDetector
+	timeline              bool
+	width                 int
+	events                int
+	resumed               time.Time
+	listeners             []TransitionFunc
+	pending               []*Transition
+	bus                   *Bus
+	published             []Event
+	unhealthy             *Set
+	selected              string
+	mu                    sync.RWMutex
+}
+
+func NewRenderer(compact, hideSuccess bool, detector *StragglerDetector) *Renderer {
+	return &Renderer{
+		[]*codedeploy.DeploymentInfo{},
+		map[string]*Set{},
+		map[string]*ec2.Instance{},
+		map[string]*codedeploy.InstanceSummary{},
+		map[string]*codedeploy.DeploymentConfigInfo{},
+		map[string]*codedeploy.GenericRevisionInfo{},
+		map[string]*GroupHistory{},
+		map[string]*Straggler{},
+		map[string]*codedeploy.DeploymentGroupInfo{},
+		map[string]*AutoScaling{},
+		map[string][]*TargetHealth{},
+		map[string][]*AlarmState{},
+		map[string]*AgentLog{},
+		nil,
+		[]*Transition{},
+		compact,
+		hideSuccess,
+		detector,
+		false,
+		0,
+		0,
+		time.Time{},
+		[]TransitionFunc{},
+		[]*Transition{},
+		NewBus(),
+		[]Event{},
+		NewSet(),
+		"",
+		sync.RWMutex{},
+	}
+}
+
+func (r *Renderer) HasDeployment(deploymentId string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := 0; i < len(r.Deployments); i++ {
+		dId := *r.Deployments[i].DeploymentId
+		if dId == deploymentId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Renderer) GetDeployment(deploymentId string) *codedeploy.DeploymentInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := 0; i < len(r.Deployments); i++ {
+		dId := *r.Deployments[i].DeploymentId
+		if dId == deploymentId {
+			return r.Deployments[i]
+		}
+	}
+
+	return nil
+}
+
+// OnTransition registers fn to be called with every transition
+// detected from now on
+func (r *Renderer) OnTransition(fn TransitionFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *Renderer) addTransition(t *Transition) {
+	if t == nil {
+		return
+	}
+	if instance, ok := r.Instances[t.InstanceId]; ok {
+		t.InstanceName = InstanceName(instance)
+	}
+	r.pending = append(r.pending, t)
+
+	r.Transitions = append(r.Transitions, t)
+	if len(r.Transitions) > maxTransitions {
+		r.Transitions = r.Transitions[len(r.Transitions)-maxTransitions:]
+	}
+}
+
+// publish queues an event for the bus, to be sent by flush
+func (r *Renderer) publish(e Event) {
+	if e == nil {
+		return
+	}
+	r.published = append(r.published, e)
+}
+
+// Bus returns the bus the renderer publishes state changes on
+func (r *Renderer) Bus() *Bus {
+	return r.bus
+}
+
+// flush publishes pending events and hands pending transitions to the
+// listeners. It must be called without holding the lock, so subscribers
+// and listeners may use the renderer.
+func (r *Renderer) flush() {
+	r.mu.Lock()
+	pending := r.pending
+	published := r.published
+	listeners := r.listeners
+	r.pending = []*Transition{}
+	r.published = []Event{}
+	r.mu.Unlock()
+
+	for _, e := range published {
+		r.bus.Publish(e)
+	}
+
+	for _, t := range pending {
+		for _, fn := range listeners {
+			fn(t)
+		}
+	}
+}
+
+func (r *Renderer) AddDeployment(aws Aws, deploymentId string) error {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deployment *codedeploy.DeploymentInfo
+
+	// check to see if we know about this deployment
+	for i := 0; i < len(r.Deployments); i++ {
+		if *r.Deployments[i].DeploymentId == deploymentId {
+			deployment = r.Deployments[i]
+
+			// keep the status of running deployments current
+			if !IsDeploymentDone(deployment) {
+				refreshed, err := aws.GetDeployment(deploymentId)
+				if err != nil {
+					return err
+				}
+				r.addTransition(explainAlarmStop(deploymentTransition(deployment, refreshed), refreshed, r.Alarms[deploymentId]))
+				r.publish(deploymentEvent(deployment, refreshed))
+				r.Deployments[i] = refreshed
+			}
+			break
+		}
+	}
+
+	// ask aws about this deployment if we don't already know about it
+	if deployment == nil {
+		deployment, err := aws.GetDeployment(deploymentId)
+		if err != nil {
+			return err
+		}
+
+		// add deployment to our list if we just found it
+		r.addTransition(deploymentTransition(nil, deployment))
+		r.publish(deploymentEvent(nil, deployment))
+		r.Deployments = append(r.Deployments, deployment)
+		if _, ok := r.DeploymentInstanceMap[deploymentId]; !ok {
+			r.DeploymentInstanceMap[deploymentId] = NewSet()
+		}
+	}
+
+	// get list of instances that are part of this deployment
+	instanceIds, err := aws.ListDeploymentInstances(deploymentId)
+	if err != nil {
+		return err
+	}
+
+	// build a list of instance ids we don't already know about
+	newInstanceIds := []string{}
+
+	for i := 0; i < len(instanceIds); i++ {
+		if !r.DeploymentInstanceMap[deploymentId].Has(instanceIds[i]) {
+			newInstanceIds = append(newInstanceIds, instanceIds[i])
+		}
+	}
+
+	// no new instances at this point
+	if len(newInstanceIds) == 0 {
+		return nil
+	}
+
+	// get new instance data
+	ec2Instances, err := aws.DescribeInstances(newInstanceIds)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ec2Instances); i++ {
+		instanceId := *ec2Instances[i].InstanceId
+		r.DeploymentInstanceMap[deploymentId].Add(instanceId)
+		r.Instances[instanceId] = ec2Instances[i]
+	}
+
+	return nil
+}
+
+// SetDeploymentStatus changes the status of a known deployment, as told by
+// a notification, returning false if the deployment is unknown.
+// Notifications may arrive late or more than once, so changes that would
+// move the deployment backwards are ignored.
+func (r *Renderer) SetDeploymentStatus(deploymentId, status string) bool {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, deployment := range r.Deployments {
+		if *deployment.DeploymentId != deploymentId {
+			continue
+		}
+		if staleStatus(aws.StringValue(deployment.Status), status) {
+			return true
+		}
+
+		updated := *deployment
+		updated.Status = &status
+		r.addTransition(explainAlarmStop(deploymentTransition(deployment, &updated), &updated, r.Alarms[deploymentId]))
+		r.publish(deploymentEvent(deployment, &updated))
+		r.Deployments[i] = &updated
+		return true
+	}
+
+	return false
+}
+
+// SetInstanceStatus changes the status of a known instance of a
+// deployment, as told by a notification, returning false if the instance
+// is unknown. Like SetDeploymentStatus, it ignores changes that would move
+// the instance backwards.
+func (r *Renderer) SetInstanceStatus(deploymentId, instanceId, status string) bool {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instanceIds, ok := r.DeploymentInstanceMap[deploymentId]
+	if !ok || !instanceIds.Has(instanceId) {
+		return false
+	}
+
+	// summaries identify instances by arn
+	arn := "instance/" + instanceId
+	summary := &codedeploy.InstanceSummary{
+		DeploymentId: &deploymentId,
+		InstanceId:   &arn,
+	}
+	// a summary of an earlier deployment of the instance says nothing
+	// about this one
+	if prev, ok := r.InstanceSummaries[instanceId]; ok && aws.StringValue(prev.DeploymentId) == deploymentId {
+		if staleStatus(aws.StringValue(prev.Status), status) {
+			return true
+		}
+		copied := *prev
+		summary = &copied
+	}
+	summary.Status = &status
+
+	r.doUpdate(summary)
+	return true
+}
+
+// RemoveDeployment forgets a deployment along with its instances
+func (r *Renderer) RemoveDeployment(deploymentId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < len(r.Deployments); i++ {
+		if *r.Deployments[i].DeploymentId == deploymentId {
+			r.Deployments = append(r.Deployments[:i], r.Deployments[i+1:]...)
+			break
+		}
+	}
+
+	delete(r.AutoScaling, deploymentId)
+	delete(r.Alarms, deploymentId)
+	delete(r.Revisions, deploymentId)
+
+	instanceIds, ok := r.DeploymentInstanceMap[deploymentId]
+	if !ok {
+		return
+	}
+	delete(r.DeploymentInstanceMap, deploymentId)
+
+	for _, instanceId := range instanceIds.List() {
+		// instances are shared by every deployment they are part of
+		shared := false
+		for _, otherInstanceIds := range r.DeploymentInstanceMap {
+			if otherInstanceIds.Has(instanceId) {
+				shared = true
+				break
+			}
+		}
+
+		if !shared {
+			delete(r.Instances, instanceId)
+			delete(r.InstanceSummaries, instanceId)
+			delete(r.Stragglers, instanceId)
+			delete(r.TargetHealth, instanceId)
+			delete(r.AgentLogs, instanceId)
+			r.unhealthy.Remove(instanceId)
+		}
+	}
+}
+
+// FinishedDeploymentIds lists deployments that completed more than age ago
+func (r *Renderer) FinishedDeploymentIds(age time.Duration) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := []string{}
+	for _, deployment := range r.Deployments {
+		if IsDeploymentDone(deployment) && deployment.CompleteTime != nil && time.Since(*deployment.CompleteTime) > age {
+			list = append(list, *deployment.DeploymentId)
+		}
+	}
+	return list
+}
+
+// LoadDeployment fetches a deployment along with the summaries of all
+// of its instances in a single pass, for commands that do not poll
+func (r *Renderer) LoadDeployment(aws Aws, deploymentId string) error {
+	err := r.AddDeployment(aws, deploymentId)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := aws.BatchGetDeploymentInstances(deploymentId, r.InstanceIds(deploymentId))
+	if err != nil {
+		return err
+	}
+
+	r.BatchUpdate(summaries)
+
+	return nil
+}
+
+// AddDeploymentConfig fetches the deployment config used by a known
+// deployment, if it has not already been fetched
+func (r *Renderer) AddDeploymentConfig(aws Aws, deploymentId string) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil || deployment.DeploymentConfigName == nil {
+		return nil
+	}
+
+	configName := *deployment.DeploymentConfigName
+
+	r.mu.RLock()
+	_, ok := r.DeploymentConfigs[configName]
+	r.mu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	config, err := aws.GetDeploymentConfig(configName)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.DeploymentConfigs[configName] = config
+
+	return nil
+}
+
+// AddRevision fetches the registered details of the application revision
+// of a known deployment, if they have not already been fetched
+func (r *Renderer) AddRevision(aws Aws, deploymentId string) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil || deployment.Revision == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	_, ok := r.Revisions[deploymentId]
+	r.mu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	info, err := aws.GetApplicationRevision(*deployment.ApplicationName, deployment.Revision)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Revisions[deploymentId] = info
+
+	return nil
+}
+
+// AddGroupHistory analyzes the recent history of the deployment group
+// of a known deployment, if it has not already been analyzed
+func (r *Renderer) AddGroupHistory(aws Aws, deploymentId string, window time.Duration) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil {
+		return nil
+	}
+
+	key := groupKey(deployment)
+
+	r.mu.RLock()
+	_, ok := r.GroupHistories[key]
+	r.mu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	end := time.Now()
+	if deployment.CreateTime != nil {
+		end = *deployment.CreateTime
+	}
+
+	history, err := AnalyzeHistory(aws, *deployment.ApplicationName, *deployment.DeploymentGroupName, end.Add(-window), end, 20)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.GroupHistories[key] = history
+
+	return nil
+}
+
+// AddAutoScaling fetches the capacity and recent activity of the auto
+// scaling groups targeted by the deployment group of a known deployment
+func (r *Renderer) AddAutoScaling(aws Aws, deploymentId string) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil {
+		return nil
+	}
+
+	group, err := r.deploymentGroup(aws, deployment)
+	if err != nil {
+		return err
+	}
+	if len(group.AutoScalingGroups) == 0 {
+		return nil
+	}
+
+	names := scalingGroupNames(group)
+	activities := []*autoscaling.Activity{}
+	for _, name := range names {
+		groupActivities, err := aws.DescribeScalingActivities(name)
+		if err != nil {
+			return err
+		}
+		activities = append(activities, groupActivities...)
+	}
+	sortActivities(activities)
+
+	groups, err := aws.DescribeAutoScalingGroups(names)
+	if err != nil {
+		return err
+	}
+
+	since := time.Time{}
+	if deployment.CreateTime != nil {
+		since = *deployment.CreateTime
+	}
+	scaling := NewAutoScaling(groups, activities, since)
+
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.AutoScaling[deploymentId]
+	for instanceId, s := range scaling.Instances {
+		if prev == nil || prev.Instances[instanceId] == nil || prev.Instances[instanceId].Cause != s.Cause {
+			r.publish(&InstanceScaled{time.Now(), deploymentId, instanceId, s.Group, s.Cause})
+		}
+	}
+	r.AutoScaling[deploymentId] = scaling
+
+	return nil
+}
+
+// AddTargetHealth fetches the health of the instances of a known
+// deployment in the classic load balancers of its deployment group and
+// in the given target groups, flagging instances that succeeded but are
+// unhealthy
+func (r *Renderer) AddTargetHealth(aws Aws, deploymentId string, targetGroups []string) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil {
+		return nil
+	}
+
+	group, err := r.deploymentGroup(aws, deployment)
+	if err != nil {
+		return err
+	}
+
+	loadBalancers := loadBalancerNames(group)
+	if len(loadBalancers) == 0 && len(targetGroups) == 0 {
+		return nil
+	}
+
+	health, err := LoadBalancerHealth(aws, loadBalancers, targetGroups)
+	if err != nil {
+		return err
+	}
+
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, instanceId := range r.DeploymentInstanceMap[deploymentId].List() {
+		for _, h := range health[instanceId] {
+			prev := ""
+			for _, p := range r.TargetHealth[instanceId] {
+				if p.LoadBalancer == h.LoadBalancer {
+					prev = p.State
+				}
+			}
+			if h.State != prev {
+				r.publish(&TargetHealthChanged{time.Now(), deploymentId, instanceId, h.LoadBalancer, prev, h.State, h.Reason})
+			}
+		}
+		r.TargetHealth[instanceId] = health[instanceId]
+
+		unhealthy := unhealthyTarget(r.InstanceSummaries[instanceId], health[instanceId])
+		if unhealthy == nil {
+			r.unhealthy.Remove(instanceId)
+		} else if !r.unhealthy.Has(instanceId) {
+			r.unhealthy.Add(instanceId)
+
+			t := newTransition(InstanceUnhealthy, deployment)
+			t.InstanceId = instanceId
+			t.Message = fmt.Sprintf("%s in %s", unhealthy.State, unhealthy.LoadBalancer)
+			if unhealthy.Description != "" {
+				t.Message += ": " + unhealthy.Description
+			}
+			r.addTransition(t)
+		}
+	}
+
+	return nil
+}
+
+// AddAlarms fetches the state of the alarms that stop a known deployment
+// when they go into ALARM
+func (r *Renderer) AddAlarms(aws Aws, deploymentId string) error {
+	deployment := r.GetDeployment(deploymentId)
+	if deployment == nil {
+		return nil
+	}
+
+	group, err := r.deploymentGroup(aws, deployment)
+	if err != nil {
+		return err
+	}
+
+	names := alarmNames(group)
+	if len(names) == 0 {
+		return nil
+	}
+
+	alarms, err := aws.DescribeAlarms(names)
+	if err != nil {
+		return err
+	}
+	states := NewAlarmStates(names, alarms)
+
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := map[string]string{}
+	for _, alarm := range r.Alarms[deploymentId] {
+		prev[alarm.Name] = alarm.State
+	}
+
+	for _, alarm := range states {
+		if alarm.State == prev[alarm.Name] {
+			continue
+		}
+		r.publish(&AlarmStateChanged{time.Now(), deploymentId, alarm.Name, prev[alarm.Name], alarm.State, alarm.Reason})
+
+		if alarm.Alarming() && !IsDeploymentDone(deployment) {
+			t := newTransition(AlarmTriggered, deployment)
+			t.Message = fmt.Sprintf("alarm %s is in ALARM, CodeDeploy will stop the deployment: %s", alarm.Name, alarm.Reason)
+			r.addTransition(t)
+		}
+	}
+	r.Alarms[deploymentId] = states
+
+	return nil
+}
+
+// AddAgentLog keeps the agent log fetched from an instance
+func (r *Renderer) AddAgentLog(agentLog *AgentLog) {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.AgentLogs[agentLog.InstanceId] = agentLog
+	r.publish(&AgentLogFetched{agentLog.Time, agentLog.DeploymentId, agentLog.InstanceId, agentLog.Status})
+}
+
+// SetPipeline sets the progress of the followed pipeline execution,
+// publishing the stages that changed status
+func (r *Renderer) SetPipeline(pipeline *Pipeline) {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := map[string]string{}
+	if r.Pipeline != nil && r.Pipeline.ExecutionId == pipeline.ExecutionId {
+		for _, stage := range r.Pipeline.Stages {
+			prev[stage.Name] = stage.Status
+		}
+	}
+
+	now := time.Now()
+	for _, stage := range pipeline.Stages {
+		if stage.Status != prev[stage.Name] {
+			r.publish(&PipelineStageChanged{now, pipeline.Name, pipeline.ExecutionId, stage.Name, prev[stage.Name], stage.Status})
+		}
+	}
+
+	r.Pipeline = pipeline
+}
+
+// AgentLog returns the agent log fetched from an instance, nil if none was
+func (r *Renderer) AgentLog(instanceId string) *AgentLog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.AgentLogs[instanceId]
+}
+
+// deploymentGroup returns the deployment group of a deployment, fetching
+// it the first time it is asked for
+func (r *Renderer) deploymentGroup(aws Aws, deployment *codedeploy.DeploymentInfo) (*codedeploy.DeploymentGroupInfo, error) {
+	key := groupKey(deployment)
+
+	r.mu.RLock()
+	group, ok := r.DeploymentGroups[key]
+	r.mu.RUnlock()
+	if ok {
+		return group, nil
+	}
+
+	group, err := aws.GetDeploymentGroup(*deployment.ApplicationName, *deployment.DeploymentGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.DeploymentGroups[key] = group
+
+	return group, nil
+}
+
+// scalingActivity returns what auto scaling did to an instance during a deployment, if anything
+func (r *Renderer) scalingActivity(deploymentId, instanceId string) *ScalingActivity {
+	if scaling, ok := r.AutoScaling[deploymentId]; ok {
+		return scaling.Instances[instanceId]
+	}
+	return nil
+}
+
+func groupKey(deployment *codedeploy.DeploymentInfo) string {
+	return *deployment.ApplicationName + "/" + *deployment.DeploymentGroupName
+}
+
+func (r *Renderer) etaEstimator(deployment *codedeploy.DeploymentInfo, instanceIds []string) *EtaEstimator {
+	return NewEtaEstimator(r.summaries(instanceIds), r.GroupHistories[groupKey(deployment)])
+}
+
+func (r *Renderer) deploymentEta(deployment *codedeploy.DeploymentInfo, instanceIds []string, estimator *EtaEstimator) (int, bool) {
+	return estimator.Deployment(r.summaries(instanceIds), MaxConcurrentInstances(r.deploymentConfig(deployment), len(instanceIds)))
+}
+
+func (r *Renderer) deploymentConfig(deployment *codedeploy.DeploymentInfo) *codedeploy.DeploymentConfigInfo {
+	if deployment.DeploymentConfigName == nil {
+		return nil
+	}
+	return r.DeploymentConfigs[*deployment.DeploymentConfigName]
+}
+
+// summaries returns the summary for each instance id, nil if unknown
+func (r *Renderer) summaries(instanceIds []string) []*codedeploy.InstanceSummary {
+	result := make([]*codedeploy.InstanceSummary, len(instanceIds))
+	for i, instanceId := range instanceIds {
+		result[i] = r.InstanceSummaries[instanceId]
+	}
+	return result
+}
+
+func (r *Renderer) getBytes() []byte {
+	var b bytes.Buffer
+
+	b.WriteString(PipelineLines(r.Pipeline))
+
+	for _, deployment := range r.Deployments {
+		deploymentId := *deployment.DeploymentId
+		instanceIds := r.DeploymentInstanceMap[deploymentId].List()
+
+		// short-circuit for deployments with 0 instances
+		if len(instanceIds) == 0 {
+			continue
+		}
+
+		numSuccess := r.countSuccess(instanceIds)
+		sort.Strings(instanceIds)
+
+		estimator := r.etaEstimator(deployment, instanceIds)
+		b.WriteString(DeploymentLine(deployment, numSuccess, len(instanceIds), FailureBudgetStr(r.failureBudget(deployment, instanceIds))+EtaStr(r.deploymentEta(deployment, instanceIds, estimator))+AutoScalingStr(r.AutoScaling[deploymentId])+AlarmsStr(r.Alarms[deploymentId])))
+		b.WriteString(RevisionLine(deployment.Revision, r.Revisions[deploymentId]))
+		b.WriteString(AlarmLines(deployment, r.Alarms[deploymentId]))
+
+		if r.timeline {
+			b.WriteString(TimelineText(r.getTimeline(deployment), r.width))
+			continue
+		}
+
+		for _, instanceId := range instanceIds {
+			if !r.visible(instanceId) {
+				continue
+			}
+			instance := r.Instances[instanceId]
+			summary := r.InstanceSummaries[instanceId]
+
+			var line bytes.Buffer
+			annotations := ScalingStr(r.scalingActivity(deploymentId, instanceId)) + TargetHealthStr(summary, r.TargetHealth[instanceId]) +
+				AgentLogStr(r.AgentLogs[instanceId]) + StragglerStr(r.Stragglers[instanceId]) + EtaStr(estimator.Instance(summary))
+
+			if r.compact {
+				line.WriteString(CompactInstanceLine(instance, summary, r.maxInstanceNameLength(), annotations))
+			} else {
+				line.WriteString(InstanceLine(instance, annotations))
+
+				if summary != nil {
+					for _, lifecycleEvent := range summary.LifecycleEvents {
+						line.WriteString(LifecycleEventLine(lifecycleEvent))
+					}
+				}
+			}
+
+			if instanceId == r.selected {
+				b.WriteString(StrColor(">", "yellow"))
+				line.Next(1)
+			}
+			b.Write(line.Bytes())
+		}
+	}
+
+	if r.events > 0 && len(r.Transitions) > 0 {
+		b.WriteString(r.eventLines())
+	}
+
+	return b.Bytes()
+}
+
+// visible is true when an instance is listed in the instance view
+func (r *Renderer) visible(instanceId string) bool {
+	summary := r.InstanceSummaries[instanceId]
+	if r.Instances[instanceId] == nil || summary == nil {
+		return false
+	}
+
+	return !(*summary.Status == "Succeeded" && r.hideSuccess)
+}
+
+// Select moves the selection by delta instances through the instances
+// listed in the instance view, selecting the first if none is selected
+func (r *Renderer) Select(delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instanceIds := []string{}
+	current := -1
+	for _, deployment := range r.Deployments {
+		ids := r.DeploymentInstanceMap[*deployment.DeploymentId].List()
+		sort.Strings(ids)
+		for _, instanceId := range ids {
+			if !r.visible(instanceId) {
+				continue
+			}
+			if instanceId == r.selected {
+				current = len(instanceIds)
+			}
+			instanceIds = append(instanceIds, instanceId)
+		}
+	}
+
+	if len(instanceIds) == 0 {
+		r.selected = ""
+		return
+	}
+
+	i := 0
+	if current >= 0 {
+		i = current + delta
+	}
+	if i < 0 {
+		i = 0
+	} else if i >= len(instanceIds) {
+		i = len(instanceIds) - 1
+	}
+	r.selected = instanceIds[i]
+}
+
+// Selected returns the selected instance along with the deployment it is
+// listed under, nil if no instance is selected
+func (r *Renderer) Selected() (*codedeploy.DeploymentInfo, string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.selected == "" {
+		return nil, ""
+	}
+
+	for _, deployment := range r.Deployments {
+		if r.DeploymentInstanceMap[*deployment.DeploymentId].Has(r.selected) {
+			return deployment, r.selected
+		}
+	}
+
+	return nil, ""
+}
+
+// eventLines lists the most recent transitions, marking where a
+// resumed watch picked up from its saved state
+func (r *Renderer) eventLines() string {
+	var b bytes.Buffer
+
+	b.WriteString("Events:\n")
+
+	transitions := r.Transitions
+	if len(transitions) > r.events {
+		transitions = transitions[len(transitions)-r.events:]
+	}
+	for i, t := range transitions {
+		if !r.resumed.IsZero() && t.Time.After(r.resumed) && (i == 0 || !transitions[i-1].Time.After(r.resumed)) {
+			b.WriteString(fmt.Sprintf("  %s\n", StrColor(fmt.Sprintf("-- resumed from state saved at %s --", r.resumed.Local().Format("15:04:05")), "white")))
+		}
+		b.WriteString(TransitionLine(t))
+	}
+
+	return b.String()
+}
+
+func (r *Renderer) Bytes() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.getBytes()
+}
+
+func (r *Renderer) String() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return string(r.getBytes())
+}
+
+// ToggleTimeline switches between the instance list and timeline views
+func (r *Renderer) ToggleTimeline() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timeline = !r.timeline
+	return r.timeline
+}
+
+// SetEvents sets how many recent transitions are listed below the deployments
+func (r *Renderer) SetEvents(events int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = events
+}
+
+// SetWidth sets the number of columns available to the timeline view
+func (r *Renderer) SetWidth(width int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.width = width
+}
+
+func (r *Renderer) Timeline(deploymentId string) *Timeline {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, deployment := range r.Deployments {
+		if *deployment.DeploymentId == deploymentId {
+			return r.getTimeline(deployment)
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) getTimeline(deployment *codedeploy.DeploymentInfo) *Timeline {
+	summaries := map[string]*codedeploy.InstanceSummary{}
+	for _, instanceId := range r.DeploymentInstanceMap[*deployment.DeploymentId].List() {
+		if summary, ok := r.InstanceSummaries[instanceId]; ok {
+			summaries[instanceId] = summary
+		}
+	}
+
+	return NewTimeline(deployment, r.Instances, summaries, time.Now())
+}
+
+func (r *Renderer) maxInstanceNameLength() int {
+	max := 0
+	for _, instance := range r.Instances {
+		l := len([]rune(InstanceName(instance)))
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+func (r *Renderer) DeploymentIds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]string, 0)
+	for item := range r.DeploymentInstanceMap {
+		list = append(list, item)
+	}
+	return list
+}
+
+func (r *Renderer) InstanceIds(deploymentId string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if instances, ok := r.DeploymentInstanceMap[deploymentId]; ok {
+		return instances.List()
+	}
+
+	return []string{}
+}
+
+func (r *Renderer) countSuccess(instanceIds []string) int {
+	return r.countStatus(instanceIds, "Succeeded")
+}
+
+func (r *Renderer) countStatus(instanceIds []string, status string) int {
+	total := 0
+	for _, instanceId := range instanceIds {
+		if summary, ok := r.InstanceSummaries[instanceId]; ok {
+			if *summary.Status == status {
+				total += 1
+			}
+		}
+	}
+	return total
+}
+
+// failureBudget is how many more instances of a running deployment can
+// fail before CodeDeploy fails it, out of how many could fail in all
+func (r *Renderer) failureBudget(deployment *codedeploy.DeploymentInfo, instanceIds []string) (int, int, bool) {
+	if IsDeploymentDone(deployment) {
+		return 0, 0, false
+	}
+	return FailureBudget(r.deploymentConfig(deployment), len(instanceIds), r.countStatus(instanceIds, "Failed"))
+}
+
+// IsDeploymentDone is true once a deployment has reached a terminal status
+func IsDeploymentDone(deployment *codedeploy.DeploymentInfo) bool {
+	if deployment == nil || deployment.Status == nil {
+		return false
+	}
+
+	return IsDeploymentStatusDone(*deployment.Status)
+}
+
+func IsDeploymentStatusDone(status string) bool {
+	switch status {
+	case "Succeeded", "Failed", "Stopped":
+		return true
+	default:
+		return false
+	}
+}
+
+// InstanceActivity counts the instances of running deployments that are
+// in progress, and the instances and deployments still waiting to start
+func (r *Renderer) InstanceActivity() (inProgress, waiting int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, deployment := range r.Deployments {
+		if IsDeploymentDone(deployment) {
+			continue
+		}
+
+		switch aws.StringValue(deployment.Status) {
+		case "Created", "Queued", "Ready":
+			waiting += 1
+		}
+
+		for _, instanceId := range r.DeploymentInstanceMap[*deployment.DeploymentId].List() {
+			summary := r.InstanceSummaries[instanceId]
+			if summary == nil {
+				waiting += 1
+				continue
+			}
+
+			switch aws.StringValue(summary.Status) {
+			case "InProgress":
+				inProgress += 1
+			case "Pending", "Ready", "Unknown":
+				waiting += 1
+			}
+		}
+	}
+
+	return inProgress, waiting
+}
+
+// IsInstanceDone is true once an instance finished its part of a
+// deployment. A summary from another deployment of the instance does not
+// count, the instance may be redeployed while an earlier one is kept.
+func (r *Renderer) IsInstanceDone(deploymentId, instanceId string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if summary, ok := r.InstanceSummaries[instanceId]; ok && aws.StringValue(summary.DeploymentId) == deploymentId {
+		status := *summary.Status
+		if status != "Pending" && status != "InProgress" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckStragglers re-evaluates every running instance and returns the
+// ones that were newly flagged, or changed lifecycle event or lag
+func (r *Renderer) CheckStragglers() []*Straggler {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flagged := []*Straggler{}
+
+	for _, deployment := range r.Deployments {
+		deploymentId := *deployment.DeploymentId
+		instanceIds := r.DeploymentInstanceMap[deploymentId].List()
+
+		peers := NewDurationSamples()
+		for _, summary := range r.summaries(instanceIds) {
+			peers.Add(summary)
+		}
+
+		for _, instanceId := range instanceIds {
+			straggler := r.detector.Detect(deploymentId, instanceId, r.InstanceSummaries[instanceId], peers)
+			if straggler == nil {
+				delete(r.Stragglers, instanceId)
+				continue
+			}
+
+			prev := r.Stragglers[instanceId]
+			if prev == nil || prev.Lag != straggler.Lag || prev.LifecycleEventName != straggler.LifecycleEventName {
+				flagged = append(flagged, straggler)
+
+				if straggler.Lag == LagStuck {
+					t := newTransition(InstanceStuck, deployment)
+					t.InstanceId = instanceId
+					t.LifecycleEventName = straggler.LifecycleEventName
+					t.Message = fmt.Sprintf("%s elapsed", strings.TrimSpace(DurationStr(straggler.Elapsed)))
+					r.addTransition(t)
+				}
+			}
+			r.Stragglers[instanceId] = straggler
+		}
+	}
+
+	return flagged
+}
+
+func (r *Renderer) Update(summary *codedeploy.InstanceSummary) {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.doUpdate(summary)
+}
+
+func (r *Renderer) BatchUpdate(summaries []*codedeploy.InstanceSummary) {
+	defer r.flush()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, summary := range summaries {
+		r.doUpdate(summary)
+	}
+}
+
+func (r *Renderer) doUpdate(summary *codedeploy.InstanceSummary) {
+	instanceArnId := *summary.InstanceId
+	result := strings.Split(instanceArnId, "/")
+	if len(result) == 2 {
+		prev := r.InstanceSummaries[result[1]]
+
+		// summaries are kept per instance, for its latest deployment
+		if prev != nil && aws.StringValue(prev.DeploymentId) != aws.StringValue(summary.DeploymentId) {
+			if r.isNewerDeployment(aws.StringValue(prev.DeploymentId), aws.StringValue(summary.DeploymentId)) {
+				return
+			}
+			prev = nil
+		}
+
+		deployment := r.findDeployment(aws.StringValue(summary.DeploymentId))
+		// skip failures that happened before we started watching a finished deployment
+		if deployment != nil && (prev != nil || !IsDeploymentDone(deployment)) {
+			for _, t := range lifecycleTransitions(deployment, prev, summary) {
+				r.addTransition(t)
+			}
+		}
+
+		r.publishChanges(result[1], prev, summary)
+		r.InstanceSummaries[result[1]] = summary
+	}
+}
+
+// publishChanges compares the previously known summary of an instance,
+// nil if it was unknown, with its current summary
+func (r *Renderer) publishChanges(instanceId string, prev, summary *codedeploy.InstanceSummary) {
+	now := time.Now()
+	deploymentId := aws.StringValue(summary.DeploymentId)
+
+	prevStatus := ""
+	if prev != nil {
+		prevStatus = aws.StringValue(prev.Status)
+	}
+	if status := aws.StringValue(summary.Status); status != prevStatus {
+		r.publish(&InstanceStatusChanged{now, deploymentId, instanceId, prevStatus, status})
+	}
+
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		name := aws.StringValue(lifecycleEvent.LifecycleEventName)
+		status := aws.StringValue(lifecycleEvent.Status)
+
+		prevStatus := ""
+		if prev != nil {
+			prevStatus = lifecycleEventStatus(prev, name)
+		} else if status == "Pending" {
+			// every lifecycle event starts out pending
+			continue
+		}
+		if status != prevStatus {
+			r.publish(&LifecycleEventChanged{now, deploymentId, instanceId, name, prevStatus, status})
+		}
+	}
+}
+
+// isNewerDeployment is true if a known deployment was created after another
+func (r *Renderer) isNewerDeployment(deploymentId, otherId string) bool {
+	deployment := r.findDeployment(deploymentId)
+	other := r.findDeployment(otherId)
+	if deployment == nil || other == nil || deployment.CreateTime == nil || other.CreateTime == nil {
+		return false
+	}
+	return deployment.CreateTime.After(*other.CreateTime)
+}
+
+func (r *Renderer) findDeployment(deploymentId string) *codedeploy.DeploymentInfo {
+	for _, deployment := range r.Deployments {
+		if *deployment.DeploymentId == deploymentId {
+			return deployment
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Report is everything known about a single deployment, for rendering
+// as a self-contained document
+type Report struct {
+	Generated   time.Time
+	Deployment  *DeploymentSnapshot
+	Creator     string
+	Description string
+	Revision    string
+	Config      string
+	Overview    []*ReportCount
+	Failures    []*ReportFailure
+	Timeline    *Timeline
+}
+
+type ReportCount struct {
+	Status string
+	Count  int64
+}
+
+// ReportFailure is a failed lifecycle event of one instance
+type ReportFailure struct {
+	Instance       string
+	LifecycleEvent string
+	Diagnostics    *DiagnosticsSnapshot
+}
+
+// Report collects what the renderer knows about a deployment, nil if
+// the deployment is unknown
+func (r *Renderer) Report(deploymentId string) *Report {
+	deployment := r.GetDeployment(deploymentId)
+	snapshot := r.Snapshot().Deployment(deploymentId)
+	if deployment == nil || snapshot == nil {
+		return nil
+	}
+
+	report := &Report{
+		Generated:   time.Now(),
+		Deployment:  snapshot,
+		Creator:     aws.StringValue(deployment.Creator),
+		Description: aws.StringValue(deployment.Description),
+		Revision:    RevisionStr(deployment.Revision),
+		Config:      snapshot.DeploymentConfigName,
+		Overview:    []*ReportCount{},
+		Failures:    []*ReportFailure{},
+		Timeline:    r.Timeline(deploymentId),
+	}
+
+	r.mu.RLock()
+	config := r.deploymentConfig(deployment)
+	r.mu.RUnlock()
+	if config != nil && config.MinimumHealthyHosts != nil {
+		report.Config += fmt.Sprintf(" (minimum healthy hosts %d %s)",
+			aws.Int64Value(config.MinimumHealthyHosts.Value), aws.StringValue(config.MinimumHealthyHosts.Type))
+	}
+
+	if overview := deployment.DeploymentOverview; overview != nil {
+		report.Overview = []*ReportCount{
+			{"Pending", aws.Int64Value(overview.Pending)},
+			{"InProgress", aws.Int64Value(overview.InProgress)},
+			{"Succeeded", aws.Int64Value(overview.Succeeded)},
+			{"Failed", aws.Int64Value(overview.Failed)},
+			{"Skipped", aws.Int64Value(overview.Skipped)},
+			{"Ready", aws.Int64Value(overview.Ready)},
+		}
+	}
+
+	for _, i := range snapshot.Instances {
+		for _, e := range i.LifecycleEvents {
+			if e.Status == "Failed" {
+				report.Failures = append(report.Failures, &ReportFailure{reportInstanceName(i), e.Name, e.Diagnostics})
+			}
+		}
+	}
+
+	return report
+}
+
+func reportInstanceName(i *InstanceSnapshot) string {
+	if i.Name == "" {
+		return i.InstanceId
+	}
+	return fmt.Sprintf("%s (%s)", i.Name, i.InstanceId)
+}
+
+// reportFuncs returns the template functions shared by html and markdown reports
+func reportFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"duration": func(seconds int) string {
+			return strings.TrimSpace(DurationStr(seconds))
+		},
+		"time": func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.Local().Format("2006-01-02 15:04:05 MST")
+		},
+		"instanceName": reportInstanceName,
+	}
+}
+
+// WriteReportHtml renders the report as a standalone html page
+func WriteReportHtml(w io.Writer, report *Report) error {
+	funcs := htmltemplate.FuncMap(reportFuncs())
+	funcs["timeline"] = func(t *Timeline) (htmltemplate.HTML, error) {
+		var b bytes.Buffer
+		err := WriteTimelineSvg(&b, t)
+		return htmltemplate.HTML(b.String()), err
+	}
+
+	tmpl, err := htmltemplate.New("report").Funcs(funcs).Parse(reportHtmlTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, report)
+}
+
+// WriteReportMarkdown renders the report as markdown, with the timeline
+// as a mermaid gantt chart
+func WriteReportMarkdown(w io.Writer, report *Report) error {
+	funcs := template.FuncMap(reportFuncs())
+	funcs["cell"] = func(s string) string {
+		return strings.Replace(strings.Replace(s, "|", `\|`, -1), "\n", " ", -1)
+	}
+	funcs["gantt"] = reportGantt
+
+	tmpl, err := template.New("report").Funcs(funcs).Parse(reportMarkdownTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, report)
+}
+
+// reportGantt draws the timeline as a mermaid gantt chart
+func reportGantt(t *Timeline) string {
+	var b bytes.Buffer
+
+	format := "2006-01-02T15:04:05"
+	label := strings.NewReplacer(":", " ", "#", " ", ";", " ")
+
+	b.WriteString("gantt\n")
+	b.WriteString("    dateFormat YYYY-MM-DDTHH:mm:ss\n")
+	b.WriteString("    axisFormat %H:%M:%S\n")
+	for _, row := range t.Rows {
+		fmt.Fprintf(&b, "    section %s\n", label.Replace(row.Name))
+		for _, segment := range row.Segments {
+			tag := "done, "
+			if segment.Status == "Failed" {
+				tag = "crit, "
+			} else if segment.Status == "InProgress" {
+				tag = "active, "
+			}
+			fmt.Fprintf(&b, "    %s :%s%s, %s\n", label.Replace(segment.Name), tag,
+				segment.Start.UTC().Format(format), segment.End.UTC().Format(format))
+		}
+	}
+
+	return b.String()
+}
+
+const reportHtmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Deployment.DeploymentId}} {{.Deployment.ApplicationName}}-{{.Deployment.DeploymentGroupName}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { padding: 2px 10px; text-align: left; vertical-align: top; border-bottom: 1px solid #ddd; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+.Pending, .Skipped { color: #b58900; }
+.InProgress, .Ready { color: #268bd2; }
+.Succeeded { color: #2aa198; }
+.Failed, .Stopped { color: #dc322f; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Deployment.ApplicationName}}-{{.Deployment.DeploymentGroupName}} {{.Deployment.DeploymentId}}</h1>
+<table>
+<tr><th>Status</th><td class="{{.Deployment.Status}}">{{.Deployment.Status}}</td></tr>
+{{if .Deployment.ErrorMessage}}<tr><th>Error</th><td class="Failed">{{.Deployment.ErrorMessage}}</td></tr>
+{{end}}<tr><th>Created</th><td>{{time .Deployment.CreateTime}}</td></tr>
+<tr><th>Completed</th><td>{{time .Deployment.CompleteTime}}</td></tr>
+{{if .Creator}}<tr><th>Creator</th><td>{{.Creator}}</td></tr>
+{{end}}{{if .Description}}<tr><th>Description</th><td>{{.Description}}</td></tr>
+{{end}}<tr><th>Revision</th><td>{{.Revision}}</td></tr>
+<tr><th>Config</th><td>{{.Config}}</td></tr>
+</table>
+{{if .Overview}}<h2>Overview</h2>
+<table>
+<tr>{{range .Overview}}<th>{{.Status}}</th>{{end}}</tr>
+<tr>{{range .Overview}}<td class="{{.Status}}">{{.Count}}</td>{{end}}</tr>
+</table>
+{{end}}{{if .Failures}}<h2>Failures</h2>
+{{range .Failures}}<h3>{{.Instance}} {{.LifecycleEvent}}</h3>
+{{with .Diagnostics}}<p>{{.ErrorCode}} {{.ScriptName}}: {{.Message}}</p>
+{{if .LogTail}}<pre>{{.LogTail}}</pre>
+{{end}}{{end}}{{end}}{{end}}{{if .Timeline.Rows}}<h2>Timeline</h2>
+{{timeline .Timeline}}{{end}}<h2>Instances</h2>
+{{range .Deployment.Instances}}<h3>{{instanceName .}} <span class="{{.Status}}">{{.Status}}</span> {{duration .Duration}}</h3>
+<table>
+<tr><th>Lifecycle event</th><th>Status</th><th>Start</th><th>End</th><th>Duration</th></tr>
+{{range .LifecycleEvents}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{time .StartTime}}</td><td>{{time .EndTime}}</td><td>{{duration .Duration}}</td></tr>
+{{end}}</table>
+{{end}}<p><small>Generated by deploywatch {{.Generated.Format "2006-01-02 15:04:05 MST"}}</small></p>
+</body>
+</html>
+`
+
+const reportMarkdownTemplate = `# {{.Deployment.ApplicationName}}-{{.Deployment.DeploymentGroupName}} {{.Deployment.DeploymentId}}
+
+| | |
+|---|---|
+| Status | {{.Deployment.Status}} |
+{{if .Deployment.ErrorMessage}}| Error | {{cell .Deployment.ErrorMessage}} |
+{{end}}| Created | {{time .Deployment.CreateTime}} |
+| Completed | {{time .Deployment.CompleteTime}} |
+{{if .Creator}}| Creator | {{.Creator}} |
+{{end}}{{if .Description}}| Description | {{cell .Description}} |
+{{end}}| Revision | {{cell .Revision}} |
+| Config | {{.Config}} |
+{{if .Overview}}
+## Overview
+
+|{{range .Overview}} {{.Status}} |{{end}}
+|{{range .Overview}}---|{{end}}
+|{{range .Overview}} {{.Count}} |{{end}}
+{{end}}{{if .Failures}}
+## Failures
+{{range .Failures}}
+### {{.Instance}} {{.LifecycleEvent}}
+{{with .Diagnostics}}
+{{.ErrorCode}} {{.ScriptName}}: {{.Message}}
+{{if .LogTail}}
+` + "```" + `
+{{.LogTail}}
+` + "```" + `
+{{end}}{{end}}{{end}}{{end}}{{if .Timeline.Rows}}
+## Timeline
+
+` + "```mermaid" + `
+{{gantt .Timeline}}` + "```" + `
+{{end}}
+## Instances
+{{range .Deployment.Instances}}
+### {{instanceName .}} {{.Status}} {{duration .Duration}}
+
+| Lifecycle event | Status | Start | End | Duration |
+|---|---|---|---|---|
+{{range .LifecycleEvents}}| {{.Name}} | {{.Status}} | {{time .StartTime}} | {{time .EndTime}} | {{duration .Duration}} |
+{{end}}{{end}}
+_Generated by deploywatch {{.Generated.Format "2006-01-02 15:04:05 MST"}}_
+`
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	start := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	diagnostics := &DiagnosticsSnapshot{ErrorCode: "ScriptFailed", ScriptName: "validate.sh", Message: "exit code 1", LogTail: "<connection refused>"}
+
+	return &Report{
+		Generated: end,
+		Deployment: &DeploymentSnapshot{
+			DeploymentId:        "d-1",
+			ApplicationName:     "web",
+			DeploymentGroupName: "prod",
+			Status:              "Failed",
+			CreateTime:          &start,
+			Instances: []*InstanceSnapshot{
+				{InstanceId: "i-1", Name: "web|1", Status: "Failed", Duration: 90, LifecycleEvents: []*LifecycleEventSnapshot{
+					{Name: "ValidateService", Status: "Failed", StartTime: &start, EndTime: &end, Duration: 90, Diagnostics: diagnostics},
+				}},
+			},
+		},
+		Revision: "s3://bucket/web.zip",
+		Config:   "CodeDeployDefault.OneAtATime",
+		Overview: []*ReportCount{{"Succeeded", 0}, {"Failed", 1}},
+		Failures: []*ReportFailure{{"web|1 (i-1)", "ValidateService", diagnostics}},
+		Timeline: &Timeline{
+			DeploymentId: "d-1",
+			Start:        start,
+			End:          end,
+			Rows: []*TimelineRow{
+				{InstanceId: "i-1", Name: "web|1", Status: "Failed", Segments: []*TimelineSegment{
+					{Name: "ValidateService", Status: "Failed", Start: start, End: end},
+				}},
+			},
+		},
+	}
+}
+
+func TestWriteReportHtml(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteReportHtml(&b, testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"<h1>web-prod d-1</h1>", "&lt;connection refused&gt;", "<svg", "1m30s"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("WriteReportHtml() missing %q", expected)
+		}
+	}
+}
+
+func TestWriteReportMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteReportMarkdown(&b, testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"# web-prod d-1\n",
+		"| Revision | s3://bucket/web.zip |\n",
+		"| Succeeded | Failed |\n",
+		"```mermaid\ngantt\n",
+		"    ValidateService :crit, 2017-06-01T12:00:00, 2017-06-01T12:01:30\n",
+		"| ValidateService | Failed |",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("WriteReportMarkdown() missing %q in:\n%s", expected, b.String())
+		}
+	}
+}
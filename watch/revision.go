@@ -0,0 +1,163 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// previousDeploymentWindow is how far back to look for the previous
+// successful deployment of a group, when the group does not know it
+const previousDeploymentWindow = 30 * 24 * time.Hour
+
+// RevisionLine describes the application revision of a deployment along
+// with its registered description
+func RevisionLine(revision *codedeploy.RevisionLocation, info *codedeploy.GenericRevisionInfo) string {
+	if revision == nil {
+		return ""
+	}
+
+	line := "  revision " + RevisionStr(revision)
+	if info != nil {
+		if description := aws.StringValue(info.Description); description != "" {
+			line += fmt.Sprintf(" %q", description)
+		}
+		if info.RegisterTime != nil {
+			line += " registered " + info.RegisterTime.Local().Format("2006-01-02 15:04")
+		}
+	}
+	return StrColor(line, "white") + "\n"
+}
+
+// RevisionDiff compares the revision of a deployment with that of the
+// last successful deployment of its group before it
+type RevisionDiff struct {
+	DeploymentId         string `json:"deploymentId"`
+	Revision             string `json:"revision"`
+	PreviousDeploymentId string `json:"previousDeploymentId,omitempty"`
+	PreviousRevision     string `json:"previousRevision,omitempty"`
+	Change               string `json:"change"`
+}
+
+// NewRevisionDiff compares the revisions of two deployments, previous is
+// nil if there was no successful deployment before
+func NewRevisionDiff(deployment, previous *codedeploy.DeploymentInfo) *RevisionDiff {
+	diff := &RevisionDiff{
+		DeploymentId: aws.StringValue(deployment.DeploymentId),
+		Revision:     RevisionStr(deployment.Revision),
+	}
+	if previous == nil {
+		diff.Change = "no previous successful deployment"
+		return diff
+	}
+
+	diff.PreviousDeploymentId = aws.StringValue(previous.DeploymentId)
+	diff.PreviousRevision = RevisionStr(previous.Revision)
+	diff.Change = revisionChange(previous.Revision, deployment.Revision)
+	return diff
+}
+
+// revisionChange describes what changed from one revision to the next,
+// as a commit range for GitHub revisions of the same repository or the
+// object versions of S3 revisions of the same key
+func revisionChange(from, to *codedeploy.RevisionLocation) string {
+	if from == nil || to == nil {
+		return RevisionStr(from) + " -> " + RevisionStr(to)
+	}
+
+	if from.GitHubLocation != nil && to.GitHubLocation != nil &&
+		aws.StringValue(from.GitHubLocation.Repository) == aws.StringValue(to.GitHubLocation.Repository) {
+		fromCommit := aws.StringValue(from.GitHubLocation.CommitId)
+		toCommit := aws.StringValue(to.GitHubLocation.CommitId)
+		if fromCommit == toCommit {
+			return "same commit " + toCommit
+		}
+		return fmt.Sprintf("https://github.com/%s/compare/%s...%s", aws.StringValue(to.GitHubLocation.Repository), fromCommit, toCommit)
+	}
+
+	if from.S3Location != nil && to.S3Location != nil &&
+		aws.StringValue(from.S3Location.Bucket) == aws.StringValue(to.S3Location.Bucket) &&
+		aws.StringValue(from.S3Location.Key) == aws.StringValue(to.S3Location.Key) {
+		if from.S3Location.Version != nil && to.S3Location.Version != nil {
+			return objectChange("version", *from.S3Location.Version, *to.S3Location.Version)
+		}
+		return objectChange("etag", aws.StringValue(from.S3Location.ETag), aws.StringValue(to.S3Location.ETag))
+	}
+
+	return RevisionStr(from) + " -> " + RevisionStr(to)
+}
+
+func objectChange(kind, from, to string) string {
+	if from == to {
+		return fmt.Sprintf("same object, %s %s", kind, to)
+	}
+	return fmt.Sprintf("%s %s -> %s", kind, from, to)
+}
+
+// PreviousSuccessfulDeployment finds the last successful deployment of
+// the group of a deployment created before it, nil if there is none
+func PreviousSuccessfulDeployment(a Aws, deployment *codedeploy.DeploymentInfo) (*codedeploy.DeploymentInfo, error) {
+	deploymentId := aws.StringValue(deployment.DeploymentId)
+	end := time.Now()
+	if deployment.CreateTime != nil {
+		end = *deployment.CreateTime
+	}
+
+	// the group knows its last successful deployment, which will do
+	// unless it is this deployment or a later one
+	group, err := a.GetDeploymentGroup(aws.StringValue(deployment.ApplicationName), aws.StringValue(deployment.DeploymentGroupName))
+	if err != nil {
+		return nil, err
+	}
+	if last := group.LastSuccessfulDeployment; last != nil && last.CreateTime != nil &&
+		aws.StringValue(last.DeploymentId) != deploymentId && last.CreateTime.Before(end) {
+		return a.GetDeployment(aws.StringValue(last.DeploymentId))
+	}
+
+	// the listing order is not documented, so compare creation times
+	deploymentIds, err := a.ListDeploymentsCreatedBetween(aws.StringValue(deployment.ApplicationName), aws.StringValue(deployment.DeploymentGroupName),
+		[]string{"Succeeded"}, end.Add(-previousDeploymentWindow), end)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *codedeploy.DeploymentInfo
+	for _, id := range deploymentIds {
+		if id == deploymentId {
+			continue
+		}
+		candidate, err := a.GetDeployment(id)
+		if err != nil {
+			return nil, err
+		}
+		if candidate.CreateTime == nil || !candidate.CreateTime.Before(end) {
+			continue
+		}
+		if previous == nil || candidate.CreateTime.After(*previous.CreateTime) {
+			previous = candidate
+		}
+	}
+
+	return previous, nil
+}
+
+func WriteRevisionDiffText(w io.Writer, d *RevisionDiff) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "deployment\t%s\t%s\n", d.DeploymentId, d.Revision)
+	if d.PreviousDeploymentId != "" {
+		fmt.Fprintf(tw, "previous\t%s\t%s\n", d.PreviousDeploymentId, d.PreviousRevision)
+	}
+	fmt.Fprintf(tw, "change\t%s\n", d.Change)
+	return tw.Flush()
+}
+
+func WriteRevisionDiffJson(w io.Writer, d *RevisionDiff) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
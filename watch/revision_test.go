@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestRevisionChange(t *testing.T) {
+	github := func(repository, commit string) *codedeploy.RevisionLocation {
+		return &codedeploy.RevisionLocation{GitHubLocation: &codedeploy.GitHubLocation{Repository: aws.String(repository), CommitId: aws.String(commit)}}
+	}
+	s3 := func(key, version, etag string) *codedeploy.RevisionLocation {
+		location := &codedeploy.S3Location{Bucket: aws.String("releases"), Key: aws.String(key)}
+		if version != "" {
+			location.Version = aws.String(version)
+		}
+		if etag != "" {
+			location.ETag = aws.String(etag)
+		}
+		return &codedeploy.RevisionLocation{S3Location: location}
+	}
+
+	for _, tt := range []struct {
+		from   *codedeploy.RevisionLocation
+		to     *codedeploy.RevisionLocation
+		change string
+	}{
+		{github("org/web", "abc"), github("org/web", "def"), "https://github.com/org/web/compare/abc...def"},
+		{github("org/web", "abc"), github("org/web", "abc"), "same commit abc"},
+		{github("org/old", "abc"), github("org/web", "def"), "github.com/org/old@abc -> github.com/org/web@def"},
+		{s3("web.zip", "v1", "e1"), s3("web.zip", "v2", "e2"), "version v1 -> v2"},
+		{s3("web.zip", "", "e1"), s3("web.zip", "", "e1"), "same object, etag e1"},
+		{s3("web-1.zip", "", "e1"), s3("web-2.zip", "", "e2"), "s3://releases/web-1.zip etag e1 -> s3://releases/web-2.zip etag e2"},
+	} {
+		if change := revisionChange(tt.from, tt.to); change != tt.change {
+			t.Errorf("revisionChange(%s, %s) => %s, want %s", RevisionStr(tt.from), RevisionStr(tt.to), change, tt.change)
+		}
+	}
+}
+
+func TestNewRevisionDiff(t *testing.T) {
+	deployment := &codedeploy.DeploymentInfo{DeploymentId: aws.String("d-2")}
+
+	diff := NewRevisionDiff(deployment, nil)
+	if diff.PreviousDeploymentId != "" || diff.Change != "no previous successful deployment" {
+		t.Errorf("NewRevisionDiff(d-2, nil) => %+v", diff)
+	}
+
+	diff = NewRevisionDiff(deployment, &codedeploy.DeploymentInfo{DeploymentId: aws.String("d-1")})
+	if diff.PreviousDeploymentId != "d-1" {
+		t.Errorf("NewRevisionDiff(d-2, d-1) => %+v", diff)
+	}
+}
+
+type fakeRevisionAws struct {
+	fakeAws
+	created map[string]time.Time
+}
+
+func (f *fakeRevisionAws) ListDeploymentsCreatedBetween(string, string, []string, time.Time, time.Time) ([]string, error) {
+	return []string{"d-1", "d-3", "d-2", "d-4"}, nil
+}
+
+func (f *fakeRevisionAws) GetDeployment(deploymentId string) (*codedeploy.DeploymentInfo, error) {
+	created := f.created[deploymentId]
+	return &codedeploy.DeploymentInfo{DeploymentId: aws.String(deploymentId), CreateTime: &created}, nil
+}
+
+func TestPreviousSuccessfulDeployment(t *testing.T) {
+	now := time.Now()
+	a := &fakeRevisionAws{created: map[string]time.Time{
+		"d-1": now.Add(-3 * time.Hour),
+		"d-2": now.Add(-time.Hour),
+		"d-3": now.Add(-2 * time.Hour),
+		"d-4": now,
+	}}
+	deployment := &codedeploy.DeploymentInfo{DeploymentId: aws.String("d-4"), CreateTime: &now}
+
+	previous, err := PreviousSuccessfulDeployment(a, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous == nil || aws.StringValue(previous.DeploymentId) != "d-2" {
+		t.Errorf("PreviousSuccessfulDeployment(d-4) => %v, want d-2", previous)
+	}
+}
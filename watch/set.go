@@ -1,5 +1,5 @@
 // https://gist.github.com/fatih/6206844
-package main
+package watch
 
 import (
 	"sync"
@@ -0,0 +1,179 @@
+package watch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// Snapshot is a point-in-time, serializable copy of everything the
+// renderer knows about the watched deployments
+type Snapshot struct {
+	Time        time.Time             `json:"time"`
+	Deployments []*DeploymentSnapshot `json:"deployments"`
+	Pipeline    *Pipeline             `json:"pipeline,omitempty"`
+}
+
+type DeploymentSnapshot struct {
+	DeploymentId         string              `json:"deploymentId"`
+	ApplicationName      string              `json:"applicationName"`
+	DeploymentGroupName  string              `json:"deploymentGroupName"`
+	DeploymentConfigName string              `json:"deploymentConfigName"`
+	Status               string              `json:"status"`
+	CreateTime           *time.Time          `json:"createTime,omitempty"`
+	CompleteTime         *time.Time          `json:"completeTime,omitempty"`
+	ErrorMessage         string              `json:"errorMessage,omitempty"`
+	Revision             string              `json:"revision,omitempty"`
+	Succeeded            int                 `json:"succeeded"`
+	Total                int                 `json:"total"`
+	Eta                  *int                `json:"eta,omitempty"`
+	FailureBudget        *int                `json:"failureBudget,omitempty"`
+	AutoScalingGroups    []*ScalingGroup     `json:"autoScalingGroups,omitempty"`
+	Alarms               []*AlarmState       `json:"alarms,omitempty"`
+	Instances            []*InstanceSnapshot `json:"instances"`
+}
+
+type InstanceSnapshot struct {
+	InstanceId      string                    `json:"instanceId"`
+	Name            string                    `json:"name"`
+	Status          string                    `json:"status"`
+	InstanceType    string                    `json:"instanceType,omitempty"`
+	Duration        int                       `json:"duration"`
+	Eta             *int                      `json:"eta,omitempty"`
+	Straggler       *Straggler                `json:"straggler,omitempty"`
+	Scaling         *ScalingActivity          `json:"scaling,omitempty"`
+	TargetHealth    []*TargetHealth           `json:"targetHealth,omitempty"`
+	AgentLog        *AgentLog                 `json:"agentLog,omitempty"`
+	LifecycleEvents []*LifecycleEventSnapshot `json:"lifecycleEvents"`
+}
+
+type LifecycleEventSnapshot struct {
+	Name        string               `json:"name"`
+	Status      string               `json:"status"`
+	StartTime   *time.Time           `json:"startTime,omitempty"`
+	EndTime     *time.Time           `json:"endTime,omitempty"`
+	Duration    int                  `json:"duration"`
+	Diagnostics *DiagnosticsSnapshot `json:"diagnostics,omitempty"`
+}
+
+type DiagnosticsSnapshot struct {
+	ErrorCode  string `json:"errorCode"`
+	ScriptName string `json:"scriptName"`
+	Message    string `json:"message"`
+	LogTail    string `json:"logTail"`
+}
+
+// Deployment returns the snapshot of a single deployment, or nil
+func (s *Snapshot) Deployment(deploymentId string) *DeploymentSnapshot {
+	for _, deployment := range s.Deployments {
+		if deployment.DeploymentId == deploymentId {
+			return deployment
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) Snapshot() *Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := &Snapshot{
+		Time:        time.Now(),
+		Deployments: []*DeploymentSnapshot{},
+		Pipeline:    r.Pipeline,
+	}
+
+	for _, deployment := range r.Deployments {
+		deploymentId := *deployment.DeploymentId
+		instanceIds := r.DeploymentInstanceMap[deploymentId].List()
+		sort.Strings(instanceIds)
+
+		d := &DeploymentSnapshot{
+			DeploymentId:         deploymentId,
+			ApplicationName:      aws.StringValue(deployment.ApplicationName),
+			DeploymentGroupName:  aws.StringValue(deployment.DeploymentGroupName),
+			DeploymentConfigName: aws.StringValue(deployment.DeploymentConfigName),
+			Status:               aws.StringValue(deployment.Status),
+			CreateTime:           deployment.CreateTime,
+			CompleteTime:         deployment.CompleteTime,
+			Revision:             RevisionStr(deployment.Revision),
+			Succeeded:            r.countSuccess(instanceIds),
+			Total:                len(instanceIds),
+			Instances:            []*InstanceSnapshot{},
+		}
+		if deployment.ErrorInformation != nil {
+			d.ErrorMessage = aws.StringValue(deployment.ErrorInformation.Message)
+		}
+
+		estimator := r.etaEstimator(deployment, instanceIds)
+		d.Eta = etaPtr(r.deploymentEta(deployment, instanceIds, estimator))
+		if budget, _, ok := r.failureBudget(deployment, instanceIds); ok {
+			d.FailureBudget = &budget
+		}
+		d.Alarms = r.Alarms[deploymentId]
+		if scaling, ok := r.AutoScaling[deploymentId]; ok {
+			d.AutoScalingGroups = scaling.Groups
+		}
+
+		for _, instanceId := range instanceIds {
+			i := &InstanceSnapshot{
+				InstanceId:      instanceId,
+				Status:          "Pending",
+				Straggler:       r.Stragglers[instanceId],
+				Scaling:         r.scalingActivity(deploymentId, instanceId),
+				TargetHealth:    r.TargetHealth[instanceId],
+				AgentLog:        r.AgentLogs[instanceId],
+				LifecycleEvents: []*LifecycleEventSnapshot{},
+			}
+			if instance, ok := r.Instances[instanceId]; ok {
+				i.Name = InstanceName(instance)
+			}
+
+			if summary, ok := r.InstanceSummaries[instanceId]; ok {
+				i.Status = aws.StringValue(summary.Status)
+				i.InstanceType = InstanceType(summary)
+				i.Duration = LifecycleTotalDuration(summary)
+				i.Eta = etaPtr(estimator.Instance(summary))
+
+				for _, lifecycleEvent := range summary.LifecycleEvents {
+					i.LifecycleEvents = append(i.LifecycleEvents, &LifecycleEventSnapshot{
+						Name:        aws.StringValue(lifecycleEvent.LifecycleEventName),
+						Status:      aws.StringValue(lifecycleEvent.Status),
+						StartTime:   lifecycleEvent.StartTime,
+						EndTime:     lifecycleEvent.EndTime,
+						Duration:    LifecycleEventDuration(lifecycleEvent),
+						Diagnostics: diagnosticsSnapshot(lifecycleEvent.Diagnostics),
+					})
+				}
+			}
+
+			d.Instances = append(d.Instances, i)
+		}
+
+		snapshot.Deployments = append(snapshot.Deployments, d)
+	}
+
+	return snapshot
+}
+
+func etaPtr(seconds int, ok bool) *int {
+	if !ok {
+		return nil
+	}
+	return &seconds
+}
+
+func diagnosticsSnapshot(diagnostics *codedeploy.Diagnostics) *DiagnosticsSnapshot {
+	if diagnostics == nil {
+		return nil
+	}
+
+	return &DiagnosticsSnapshot{
+		ErrorCode:  aws.StringValue(diagnostics.ErrorCode),
+		ScriptName: aws.StringValue(diagnostics.ScriptName),
+		Message:    aws.StringValue(diagnostics.Message),
+		LogTail:    aws.StringValue(diagnostics.LogTail),
+	}
+}
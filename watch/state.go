@@ -0,0 +1,215 @@
+package watch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// State is what the renderer knows about the watched deployments,
+// persisted between runs so a restarted watch resumes where it left off
+type State struct {
+	Time                time.Time                                   `json:"time"`
+	Deployments         []*codedeploy.DeploymentInfo                `json:"deployments"`
+	DeploymentInstances map[string][]string                         `json:"deploymentInstances"`
+	Instances           map[string]*ec2.Instance                    `json:"instances"`
+	InstanceSummaries   map[string]*codedeploy.InstanceSummary      `json:"instanceSummaries"`
+	DeploymentConfigs   map[string]*codedeploy.DeploymentConfigInfo `json:"deploymentConfigs"`
+	Transitions         []*Transition                               `json:"transitions"`
+}
+
+// State copies the renderer's current state
+func (r *Renderer) State() *State {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state := &State{
+		Deployments:         append([]*codedeploy.DeploymentInfo{}, r.Deployments...),
+		DeploymentInstances: map[string][]string{},
+		Instances:           map[string]*ec2.Instance{},
+		InstanceSummaries:   map[string]*codedeploy.InstanceSummary{},
+		DeploymentConfigs:   map[string]*codedeploy.DeploymentConfigInfo{},
+		Transitions:         append([]*Transition{}, r.Transitions...),
+	}
+	for deploymentId, instanceIds := range r.DeploymentInstanceMap {
+		state.DeploymentInstances[deploymentId] = instanceIds.List()
+	}
+	for instanceId, instance := range r.Instances {
+		state.Instances[instanceId] = instance
+	}
+	for instanceId, summary := range r.InstanceSummaries {
+		state.InstanceSummaries[instanceId] = summary
+	}
+	for configName, config := range r.DeploymentConfigs {
+		state.DeploymentConfigs[configName] = config
+	}
+
+	return state
+}
+
+// Restore replaces the renderer's state with a saved state. Changes
+// since the state was saved are detected as transitions by the next poll.
+func (r *Renderer) Restore(state *State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Deployments = state.Deployments
+	r.DeploymentInstanceMap = map[string]*Set{}
+	for deploymentId, instanceIds := range state.DeploymentInstances {
+		set := NewSet()
+		for _, instanceId := range instanceIds {
+			set.Add(instanceId)
+		}
+		r.DeploymentInstanceMap[deploymentId] = set
+	}
+	for _, deployment := range r.Deployments {
+		if _, ok := r.DeploymentInstanceMap[*deployment.DeploymentId]; !ok {
+			r.DeploymentInstanceMap[*deployment.DeploymentId] = NewSet()
+		}
+	}
+	if state.Instances != nil {
+		r.Instances = state.Instances
+	}
+	if state.InstanceSummaries != nil {
+		r.InstanceSummaries = state.InstanceSummaries
+	}
+	if state.DeploymentConfigs != nil {
+		r.DeploymentConfigs = state.DeploymentConfigs
+	}
+	if state.Transitions != nil {
+		r.Transitions = state.Transitions
+	}
+	r.resumed = state.Time
+}
+
+// StateStore saves renderer state to a json file
+type StateStore struct {
+	path   string
+	logger *log.Logger
+	last   []byte
+	mu     sync.Mutex
+}
+
+func NewStateStore(path string, logger *log.Logger) *StateStore {
+	return &StateStore{
+		path,
+		logger,
+		[]byte{},
+		sync.Mutex{},
+	}
+}
+
+// DefaultStatePath is the state file in the user's cache directory for
+// watching the named application's groups and deployments given by args,
+// so that separate watches do not overwrite each other's state
+func DefaultStatePath(name string, groups, args []string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	groups = append([]string{}, groups...)
+	sort.Strings(groups)
+	sum := sha1.Sum([]byte(name + "\n" + strings.Join(groups, ",") + "\n" + strings.Join(args, " ")))
+
+	return filepath.Join(dir, "deploywatch", fmt.Sprintf("state-%x.json", sum[:6]))
+}
+
+// Load reads the saved state, nil if nothing has been saved yet
+func (s *StateStore) Load() (*State, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Save writes the state, unless nothing changed since the last save.
+// The file is replaced atomically so a crash never leaves it truncated.
+func (s *StateStore) Save(state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.Time = time.Time{}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, s.last) {
+		return nil
+	}
+	s.last = data
+
+	state.Time = time.Now()
+	data, err = json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// Resume restores the renderer from the saved state, if there is one,
+// and returns the ids of the deployments that were being watched
+func (s *StateStore) Resume(renderer *Renderer) []string {
+	state, err := s.Load()
+	if err != nil {
+		s.logger.Printf("Error loading state from %s: %s\n", s.path, err)
+		return []string{}
+	}
+	if state == nil {
+		return []string{}
+	}
+
+	s.logger.Printf("Resuming %d deployments from state saved at %s\n", len(state.Deployments), state.Time)
+	renderer.Restore(state)
+
+	return renderer.DeploymentIds()
+}
+
+// Watch saves the renderer's state every few seconds
+func (s *StateStore) Watch(checker *Checker, renderer *Renderer) {
+	checker.Check(5, func() {
+		s.Checkpoint(renderer)
+	})
+}
+
+// Checkpoint saves the renderer's current state, logging failures
+func (s *StateStore) Checkpoint(renderer *Renderer) {
+	err := s.Save(renderer.State())
+	if err != nil {
+		s.logger.Printf("Error saving state to %s: %s\n", s.path, err)
+	}
+}
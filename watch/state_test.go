@@ -0,0 +1,135 @@
+package watch
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploywatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStateStore(filepath.Join(dir, "cache", "state.json"), log.New(ioutil.Discard, "", 0))
+
+	state, err := store.Load()
+	if state != nil || err != nil {
+		t.Fatalf("Load() before Save() => %v %v", state, err)
+	}
+
+	deployment := &codedeploy.DeploymentInfo{
+		DeploymentId:        aws.String("d-1"),
+		ApplicationName:     aws.String("web"),
+		DeploymentGroupName: aws.String("prod"),
+		Status:              aws.String("InProgress"),
+	}
+
+	renderer := NewRenderer(false, false, nil)
+	renderer.Deployments = append(renderer.Deployments, deployment)
+	renderer.DeploymentInstanceMap["d-1"] = NewSet()
+	renderer.DeploymentInstanceMap["d-1"].Add("i-1")
+	renderer.Instances["i-1"] = &ec2.Instance{InstanceId: aws.String("i-1")}
+	renderer.InstanceSummaries["i-1"] = &codedeploy.InstanceSummary{
+		DeploymentId: aws.String("d-1"),
+		InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+		Status:       aws.String("InProgress"),
+	}
+	renderer.addTransition(newTransition(DeploymentStarted, deployment))
+
+	err = store.Save(renderer.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := NewRenderer(false, false, nil)
+	deploymentIds := store.Resume(resumed)
+	if len(deploymentIds) != 1 || deploymentIds[0] != "d-1" {
+		t.Errorf("Resume() => %v", deploymentIds)
+	}
+	if ids := resumed.InstanceIds("d-1"); len(ids) != 1 || ids[0] != "i-1" {
+		t.Errorf("Resume() instances => %v", ids)
+	}
+	if resumed.IsInstanceDone("d-1", "i-1") {
+		t.Errorf("Resume() instance i-1 should be in progress")
+	}
+	if len(resumed.Transitions) != 1 || resumed.Transitions[0].Kind != DeploymentStarted {
+		t.Errorf("Resume() transitions => %v", resumed.Transitions)
+	}
+
+	// a deployment that finished while we were down is detected as a transition
+	finished := *deployment
+	finished.Status = aws.String("Succeeded")
+	resumed.addTransition(deploymentTransition(resumed.GetDeployment("d-1"), &finished))
+	resumed.SetEvents(5)
+
+	events := resumed.eventLines()
+	if !strings.Contains(events, "-- resumed from state saved at") || strings.Index(events, "resumed") > strings.Index(events, "deployment.succeeded") {
+		t.Errorf("eventLines() => %q", events)
+	}
+}
+
+func TestStateStoreSaveUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploywatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	store := NewStateStore(path, log.New(ioutil.Discard, "", 0))
+	renderer := NewRenderer(false, false, nil)
+
+	err = store.Save(renderer.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(path, past, past)
+
+	err = store.Save(renderer.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("Save() rewrote unchanged state")
+	}
+}
+
+func TestDefaultStatePath(t *testing.T) {
+	path := DefaultStatePath("app", []string{"a", "b"}, []string{})
+	if filepath.Base(filepath.Dir(path)) != "deploywatch" {
+		t.Errorf("DefaultStatePath() => %s, want a file in the deploywatch cache directory", path)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		groups []string
+		args   []string
+		same   bool
+	}{
+		{"app", []string{"b", "a"}, []string{}, true},
+		{"other", []string{"a", "b"}, []string{}, false},
+		{"app", []string{"a"}, []string{}, false},
+		{"app", []string{"a", "b"}, []string{"d-1"}, false},
+	} {
+		if same := DefaultStatePath(tt.name, tt.groups, tt.args) == path; same != tt.same {
+			t.Errorf("DefaultStatePath(%s, %v, %v) == %s => %v, want %v", tt.name, tt.groups, tt.args, path, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+type Lag string
+
+const (
+	LagSlow  Lag = "slow"
+	LagStuck Lag = "stuck"
+)
+
+// lifecycle events shorter than this are never flagged as slow,
+// so that hooks which usually take a second or two don't produce noise
+const minSlowElapsed = 30
+
+// Straggler is an instance whose current lifecycle event is taking
+// much longer than it took on its peers in the same deployment
+type Straggler struct {
+	DeploymentId       string `json:"deploymentId"`
+	InstanceId         string `json:"instanceId"`
+	LifecycleEventName string `json:"lifecycleEventName"`
+	Elapsed            int    `json:"elapsed"`
+	Median             int    `json:"median"`
+	Lag                Lag    `json:"lag"`
+}
+
+type StragglerDetector struct {
+	// flag an instance as slow once its current lifecycle event has
+	// taken SlowFactor times the median of its peers, 0 to disable
+	SlowFactor float64
+	// flag an instance as stuck once its current lifecycle event has
+	// taken StuckAfter, regardless of its peers, 0 to disable
+	StuckAfter time.Duration
+	// minimum number of peers that completed the same lifecycle event
+	// before the median is considered meaningful
+	MinPeers int
+}
+
+func NewStragglerDetector(slowFactor float64, stuckAfter time.Duration) *StragglerDetector {
+	return &StragglerDetector{
+		SlowFactor: slowFactor,
+		StuckAfter: stuckAfter,
+		MinPeers:   3,
+	}
+}
+
+// Detect returns a Straggler if the instance is slow or stuck, otherwise nil
+func (d *StragglerDetector) Detect(deploymentId, instanceId string, summary *codedeploy.InstanceSummary, peers *DurationSamples) *Straggler {
+	if d == nil || summary == nil || *summary.Status != "InProgress" {
+		return nil
+	}
+
+	var current *codedeploy.LifecycleEvent
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		if *lifecycleEvent.Status == "InProgress" {
+			current = lifecycleEvent
+			break
+		}
+	}
+	if current == nil {
+		return nil
+	}
+
+	s := &Straggler{
+		DeploymentId:       deploymentId,
+		InstanceId:         instanceId,
+		LifecycleEventName: *current.LifecycleEventName,
+		Elapsed:            LifecycleEventDuration(current),
+	}
+
+	if durations := peers.events[s.LifecycleEventName]; len(durations) >= d.MinPeers {
+		s.Median = NewDurationStats(s.LifecycleEventName, durations).P50
+	}
+
+	if d.StuckAfter > 0 && s.Elapsed >= int(d.StuckAfter.Seconds()) {
+		s.Lag = LagStuck
+		return s
+	}
+
+	if d.SlowFactor > 0 && s.Median > 0 && s.Elapsed >= minSlowElapsed &&
+		float64(s.Elapsed) > d.SlowFactor*float64(s.Median) {
+		s.Lag = LagSlow
+		return s
+	}
+
+	return nil
+}
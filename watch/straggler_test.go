@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+func TestStragglerDetector(t *testing.T) {
+	now := time.Now()
+
+	peers := NewDurationSamples()
+	for i := 0; i < 3; i++ {
+		peers.Add(&codedeploy.InstanceSummary{
+			Status: aws.String("Succeeded"),
+			LifecycleEvents: []*codedeploy.LifecycleEvent{
+				testLifecycleEvent("ValidateService", "Succeeded", now, 20),
+			},
+		})
+	}
+
+	running := func(elapsed time.Duration) *codedeploy.InstanceSummary {
+		return &codedeploy.InstanceSummary{
+			Status: aws.String("InProgress"),
+			LifecycleEvents: []*codedeploy.LifecycleEvent{
+				testLifecycleEvent("Install", "Succeeded", now.Add(-time.Hour), 10),
+				testLifecycleEvent("ValidateService", "InProgress", now.Add(-elapsed), -1),
+			},
+		}
+	}
+
+	d := NewStragglerDetector(3.0, 10*time.Minute)
+
+	for _, tt := range []struct {
+		elapsed time.Duration
+		peers   *DurationSamples
+		lag     Lag
+	}{
+		{30 * time.Second, peers, ""},
+		{90 * time.Second, peers, LagSlow},
+		{90 * time.Second, NewDurationSamples(), ""},
+		{11 * time.Minute, peers, LagStuck},
+		{11 * time.Minute, NewDurationSamples(), LagStuck},
+	} {
+		s := d.Detect("d-1", "i-1", running(tt.elapsed), tt.peers)
+
+		var lag Lag
+		if s != nil {
+			lag = s.Lag
+			if s.LifecycleEventName != "ValidateService" {
+				t.Errorf("Detect(%s) => flagged %s, want ValidateService", tt.elapsed, s.LifecycleEventName)
+			}
+		}
+
+		if lag != tt.lag {
+			t.Errorf("Detect(%s) => %q, want %q", tt.elapsed, lag, tt.lag)
+		}
+	}
+}
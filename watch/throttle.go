@@ -1,4 +1,4 @@
-package main
+package watch
 
 import (
 	"sync"
@@ -51,3 +51,11 @@ func (t *Throttle) Throttle() time.Duration {
 
 	return t.sleep
 }
+
+// Current returns the current sleep without decaying it
+func (t *Throttle) Current() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.sleep
+}
@@ -0,0 +1,309 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// TimelineSegment is a single lifecycle event on an instance's timeline
+type TimelineSegment struct {
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// TimelineRow is one instance's lifecycle events along the shared time axis
+type TimelineRow struct {
+	InstanceId string             `json:"instanceId"`
+	Name       string             `json:"name"`
+	Status     string             `json:"status"`
+	Segments   []*TimelineSegment `json:"segments"`
+}
+
+// Timeline lays out every instance of a deployment on a shared time axis
+type Timeline struct {
+	DeploymentId string         `json:"deploymentId"`
+	Title        string         `json:"title"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Rows         []*TimelineRow `json:"rows"`
+}
+
+func NewTimeline(deployment *codedeploy.DeploymentInfo, instances map[string]*ec2.Instance, summaries map[string]*codedeploy.InstanceSummary, now time.Time) *Timeline {
+	t := &Timeline{
+		DeploymentId: *deployment.DeploymentId,
+		Title:        fmt.Sprintf("%s-%s", *deployment.ApplicationName, *deployment.DeploymentGroupName),
+		Rows:         []*TimelineRow{},
+	}
+
+	for instanceId, summary := range summaries {
+		row := &TimelineRow{
+			InstanceId: instanceId,
+			Name:       instanceId,
+			Status:     *summary.Status,
+			Segments:   []*TimelineSegment{},
+		}
+		if instance, ok := instances[instanceId]; ok && InstanceName(instance) != "" {
+			row.Name = InstanceName(instance)
+		}
+
+		for _, lifecycleEvent := range summary.LifecycleEvents {
+			if lifecycleEvent.StartTime == nil || lifecycleEvent.StartTime.IsZero() {
+				continue
+			}
+
+			segment := &TimelineSegment{
+				Name:   *lifecycleEvent.LifecycleEventName,
+				Status: *lifecycleEvent.Status,
+				Start:  *lifecycleEvent.StartTime,
+				End:    now,
+			}
+			if lifecycleEvent.EndTime != nil && !lifecycleEvent.EndTime.IsZero() {
+				segment.End = *lifecycleEvent.EndTime
+			} else if segment.Status != "InProgress" {
+				segment.End = segment.Start
+			}
+
+			if t.Start.IsZero() || segment.Start.Before(t.Start) {
+				t.Start = segment.Start
+			}
+			if segment.End.After(t.End) {
+				t.End = segment.End
+			}
+
+			row.Segments = append(row.Segments, segment)
+		}
+
+		t.Rows = append(t.Rows, row)
+	}
+
+	// order instances by when they started, so batch waves line up
+	sort.Slice(t.Rows, func(i, j int) bool {
+		a, b := t.Rows[i].start(), t.Rows[j].start()
+		if a.Equal(b) {
+			return t.Rows[i].Name < t.Rows[j].Name
+		}
+		if a.IsZero() || b.IsZero() {
+			return b.IsZero()
+		}
+		return a.Before(b)
+	})
+
+	return t
+}
+
+func (r *TimelineRow) start() time.Time {
+	if len(r.Segments) == 0 {
+		return time.Time{}
+	}
+	return r.Segments[0].Start
+}
+
+// segmentAt returns the segment running at time at, if any
+func (r *TimelineRow) segmentAt(at time.Time) *TimelineSegment {
+	for _, segment := range r.Segments {
+		if !at.Before(segment.Start) && at.Before(segment.End) {
+			return segment
+		}
+	}
+	return nil
+}
+
+// timeline colors for lifecycle events, red is reserved for failures
+var (
+	timelineTermColors = []string{"blue", "cyan", "green", "magenta", "yellow", "white"}
+	timelineHexColors  = []string{
+		"#4e79a7", "#76b7b2", "#59a14f", "#b07aa1", "#edc948", "#9c755f", "#bab0ac",
+		"#86bcb6", "#8cd17d", "#d4a6c8", "#f1ce63", "#a0cbe8", "#79706e",
+	}
+)
+
+func timelineTermColor(segment *TimelineSegment, palette map[string]int) string {
+	if segment.Status == "Failed" {
+		return "red"
+	}
+	return timelineTermColors[palette[segment.Name]%len(timelineTermColors)]
+}
+
+func timelineHexColor(segment *TimelineSegment, palette map[string]int) string {
+	if segment.Status == "Failed" {
+		return "#e15759"
+	}
+	return timelineHexColors[palette[segment.Name]%len(timelineHexColors)]
+}
+
+// palette numbers the lifecycle events present in the timeline, so that
+// neighbouring events get distinct colors
+func (t *Timeline) palette() map[string]int {
+	palette := map[string]int{}
+	for i, name := range t.eventNames() {
+		palette[name] = i
+	}
+	return palette
+}
+
+// eventNames lists the lifecycle events present in the timeline, in run order
+func (t *Timeline) eventNames() []string {
+	samples := NewDurationSamples()
+	for _, row := range t.Rows {
+		for _, segment := range row.Segments {
+			samples.events[segment.Name] = nil
+		}
+	}
+	return samples.EventNames()
+}
+
+// TimelineText draws the timeline using termui color markup, one
+// bar per instance, fitting within width terminal columns
+func TimelineText(t *Timeline, width int) string {
+	var b bytes.Buffer
+
+	nameLen := 0
+	for _, row := range t.Rows {
+		if l := len([]rune(row.Name)); l > nameLen {
+			nameLen = l
+		}
+	}
+
+	barLen := width - nameLen - 4
+	span := t.End.Sub(t.Start)
+	if barLen < 10 || span <= 0 {
+		return ""
+	}
+	step := span / time.Duration(barLen)
+	palette := t.palette()
+
+	for _, row := range t.Rows {
+		b.WriteString("  ")
+		b.WriteString(PadRight(row.Name, " ", nameLen))
+		b.WriteString(" ")
+
+		var (
+			run      int
+			runColor string
+		)
+		flush := func() {
+			if run == 0 {
+				return
+			}
+			if runColor == "" {
+				b.WriteString(strings.Repeat(" ", run))
+			} else {
+				b.WriteString(StrColor(strings.Repeat("█", run), runColor))
+			}
+			run = 0
+		}
+
+		for i := 0; i < barLen; i++ {
+			at := t.Start.Add(step*time.Duration(i) + step/2)
+			color := ""
+			if segment := row.segmentAt(at); segment != nil {
+				color = timelineTermColor(segment, palette)
+			}
+			if color != runColor {
+				flush()
+				runColor = color
+			}
+			run += 1
+		}
+		flush()
+		b.WriteString("\n")
+	}
+
+	axis := fmt.Sprintf("%s .. %s (%s)", t.Start.Local().Format("15:04:05"), t.End.Local().Format("15:04:05"),
+		strings.TrimSpace(DurationStr(int(span.Seconds()))))
+	b.WriteString(fmt.Sprintf("  %s %s\n", strings.Repeat(" ", nameLen), axis))
+
+	legend := []string{}
+	for _, name := range t.eventNames() {
+		color := timelineTermColor(&TimelineSegment{Name: name}, palette)
+		legend = append(legend, StrColor("█ "+name, color))
+	}
+	legend = append(legend, StrColor("█ Failed", "red"))
+	b.WriteString(fmt.Sprintf("  %s\n", strings.Join(legend, " ")))
+
+	return b.String()
+}
+
+const (
+	svgWidth     = 1000
+	svgNameWidth = 200
+	svgRowHeight = 20
+	svgBarHeight = 14
+)
+
+// WriteTimelineSvg draws the timeline as a standalone svg image
+func WriteTimelineSvg(w io.Writer, t *Timeline) error {
+	var b bytes.Buffer
+
+	height := (len(t.Rows)+3)*svgRowHeight + 10
+	barWidth := float64(svgWidth - svgNameWidth - 10)
+	span := t.End.Sub(t.Start).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+	palette := t.palette()
+	x := func(at time.Time) float64 {
+		return svgNameWidth + at.Sub(t.Start).Seconds()/span*barWidth
+	}
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="12">`+"\n", svgWidth, height)
+	fmt.Fprintf(&b, `<text x="5" y="%d" font-weight="bold">%s %s</text>`+"\n", svgRowHeight-6, html.EscapeString(t.DeploymentId), html.EscapeString(t.Title))
+
+	for i, row := range t.Rows {
+		y := (i + 1) * svgRowHeight
+		fmt.Fprintf(&b, `<text x="5" y="%d">%s</text>`+"\n", y+svgBarHeight-3, html.EscapeString(row.Name))
+		for _, segment := range row.Segments {
+			width := x(segment.End) - x(segment.Start)
+			if width < 1 {
+				width = 1
+			}
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s %s %s %s</title></rect>`+"\n",
+				x(segment.Start), y, width, svgBarHeight, timelineHexColor(segment, palette),
+				html.EscapeString(row.Name), html.EscapeString(segment.Name), html.EscapeString(segment.Status),
+				strings.TrimSpace(DurationStr(int(segment.End.Sub(segment.Start).Seconds()))))
+		}
+	}
+
+	axisY := (len(t.Rows) + 1) * svgRowHeight
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`+"\n", svgNameWidth, axisY, svgWidth-10, axisY)
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", svgNameWidth, axisY+14, t.Start.Local().Format("15:04:05"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", svgWidth-10, axisY+14, t.End.Local().Format("15:04:05"))
+
+	legendX := 5
+	legendY := axisY + 2*svgRowHeight
+	for _, name := range append(t.eventNames(), "Failed") {
+		segment := &TimelineSegment{Name: name}
+		if name == "Failed" {
+			segment.Status = "Failed"
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d">%s</text>`+"\n",
+			legendX, legendY-10, timelineHexColor(segment, palette), legendX+14, legendY, html.EscapeString(name))
+		legendX += 14 + 8*len(name) + 10
+	}
+
+	b.WriteString("</svg>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteTimelineHtml wraps the svg timeline in a self-contained html page
+func WriteTimelineHtml(w io.Writer, t *Timeline) error {
+	title := html.EscapeString(fmt.Sprintf("%s %s", t.DeploymentId, t.Title))
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n", title)
+	if err := WriteTimelineSvg(w, t); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(w, "</body>\n</html>\n")
+	return err
+}
@@ -0,0 +1,168 @@
+package watch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func testTimeline(now time.Time) *Timeline {
+	start := now.Add(-10 * time.Minute)
+	deployment := &codedeploy.DeploymentInfo{
+		DeploymentId:        aws.String("d-1"),
+		ApplicationName:     aws.String("web"),
+		DeploymentGroupName: aws.String("prod"),
+	}
+	instances := map[string]*ec2.Instance{
+		"i-1": {InstanceId: aws.String("i-1"), Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("<web-1> & co")}}},
+	}
+	summaries := map[string]*codedeploy.InstanceSummary{
+		// started last
+		"i-1": {Status: aws.String("Succeeded"), LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("Install", "Succeeded", start.Add(2*time.Minute), 60),
+		}},
+		// still running, with a pending event that has not started
+		"i-2": {Status: aws.String("InProgress"), LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("Install", "Succeeded", start, 60),
+			testLifecycleEvent("ValidateService", "InProgress", start.Add(time.Minute), -1),
+			{LifecycleEventName: aws.String("AfterValidate"), Status: aws.String("Pending")},
+		}},
+		// failed without an end time, started along with i-2
+		"i-3": {Status: aws.String("Failed"), LifecycleEvents: []*codedeploy.LifecycleEvent{
+			testLifecycleEvent("Install", "Failed", start, -1),
+		}},
+		// not started yet
+		"i-4": {Status: aws.String("Pending"), LifecycleEvents: []*codedeploy.LifecycleEvent{
+			{LifecycleEventName: aws.String("Install"), Status: aws.String("Pending")},
+		}},
+	}
+	return NewTimeline(deployment, instances, summaries, now)
+}
+
+func TestNewTimeline(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-10 * time.Minute)
+	timeline := testTimeline(now)
+
+	if timeline.Title != "web-prod" || !timeline.Start.Equal(start) || !timeline.End.Equal(now) {
+		t.Errorf("NewTimeline() => %s %s .. %s, want web-prod %s .. %s", timeline.Title, timeline.Start, timeline.End, start, now)
+	}
+
+	names := []string{}
+	for _, row := range timeline.Rows {
+		names = append(names, row.Name)
+	}
+	if strings.Join(names, ",") != "i-2,i-3,<web-1> & co,i-4" {
+		t.Errorf("NewTimeline() rows => %v, want ordered by start, then name, unstarted last", names)
+	}
+
+	for _, tt := range []struct {
+		row     int
+		segment int
+		name    string
+		start   time.Time
+		end     time.Time
+	}{
+		{0, 0, "Install", start, start.Add(time.Minute)},
+		// running events last until now
+		{0, 1, "ValidateService", start.Add(time.Minute), now},
+		// other events without an end take no time
+		{1, 0, "Install", start, start},
+		{2, 0, "Install", start.Add(2 * time.Minute), start.Add(3 * time.Minute)},
+	} {
+		segment := timeline.Rows[tt.row].Segments[tt.segment]
+		if segment.Name != tt.name || !segment.Start.Equal(tt.start) || !segment.End.Equal(tt.end) {
+			t.Errorf("NewTimeline() row %d segment %d => %s %s .. %s, want %s %s .. %s", tt.row, tt.segment,
+				segment.Name, segment.Start, segment.End, tt.name, tt.start, tt.end)
+		}
+	}
+
+	for _, tt := range []struct {
+		row      int
+		segments int
+	}{
+		{0, 2},
+		{1, 1},
+		{2, 1},
+		{3, 0},
+	} {
+		if segments := len(timeline.Rows[tt.row].Segments); segments != tt.segments {
+			t.Errorf("NewTimeline() row %d => %d segments, want %d", tt.row, segments, tt.segments)
+		}
+	}
+}
+
+func TestTimelineText(t *testing.T) {
+	timeline := testTimeline(time.Now())
+
+	for _, tt := range []struct {
+		width int
+		lines int
+	}{
+		// too narrow for a bar
+		{20, 0},
+		// a bar per row, the axis and the legend
+		{80, 6},
+	} {
+		text := TimelineText(timeline, tt.width)
+		if lines := strings.Count(text, "\n"); lines != tt.lines {
+			t.Errorf("TimelineText(%d) => %d lines, want %d\n%s", tt.width, lines, tt.lines, text)
+		}
+	}
+
+	lines := strings.Split(TimelineText(timeline, 80), "\n")
+	if !strings.HasPrefix(lines[0], "  i-2") || !strings.Contains(lines[0], "](fg-") {
+		t.Errorf("TimelineText() first row => %q, want a bar for i-2", lines[0])
+	}
+	// the running event reaches the end of the axis
+	if !strings.HasSuffix(lines[0], "](fg-cyan)") {
+		t.Errorf("TimelineText() running row => %q, want a bar up to now", lines[0])
+	}
+	if strings.Contains(lines[3], "█") {
+		t.Errorf("TimelineText() unstarted row => %q, want no bar", lines[3])
+	}
+}
+
+func TestWriteTimelineSvg(t *testing.T) {
+	timeline := testTimeline(time.Now())
+
+	var b bytes.Buffer
+	if err := WriteTimelineSvg(&b, timeline); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+
+	for _, tt := range []struct {
+		s     string
+		count int
+	}{
+		{"&lt;web-1&gt; &amp; co", 2},
+		{"<web-1>", 0},
+		// a bar per segment, scaled to the 790px from x=200 to 990
+		{`height="14"`, 4},
+		{`<rect x="200.0" y="20" width="79.0"`, 1},
+		{`<rect x="279.0" y="20" width="711.0"`, 1},
+		{`<rect x="358.0" y="60" width="79.0"`, 1},
+		// failures are red in the bars and the legend
+		{`<rect x="200.0" y="40" width="1.0" height="14" fill="#e15759">`, 1},
+		{`fill="#e15759"`, 2},
+	} {
+		if count := strings.Count(svg, tt.s); count != tt.count {
+			t.Errorf("WriteTimelineSvg() => %d of %q, want %d\n%s", count, tt.s, tt.count, svg)
+		}
+	}
+
+	b.Reset()
+	if err := WriteTimelineHtml(&b, timeline); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	if !strings.Contains(page, "<title>d-1 web-prod</title>") || !strings.Contains(page, svg) || !strings.HasSuffix(page, "</html>\n") {
+		t.Errorf("WriteTimelineHtml() => %s", page)
+	}
+}
@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+type TransitionKind string
+
+const (
+	DeploymentStarted    TransitionKind = "deployment.started"
+	DeploymentSucceeded  TransitionKind = "deployment.succeeded"
+	DeploymentFailed     TransitionKind = "deployment.failed"
+	DeploymentStopped    TransitionKind = "deployment.stopped"
+	LifecycleEventFailed TransitionKind = "lifecycle_event.failed"
+	InstanceStuck        TransitionKind = "instance.stuck"
+	InstanceUnhealthy    TransitionKind = "instance.unhealthy"
+	AlarmTriggered       TransitionKind = "alarm.triggered"
+)
+
+// TransitionKinds lists every kind of transition, in the order they
+// usually happen during a deployment
+var TransitionKinds = []TransitionKind{
+	DeploymentStarted,
+	LifecycleEventFailed,
+	InstanceStuck,
+	InstanceUnhealthy,
+	AlarmTriggered,
+	DeploymentSucceeded,
+	DeploymentFailed,
+	DeploymentStopped,
+}
+
+// Transition is a notable change in the state of a deployment or
+// one of its instances
+type Transition struct {
+	Kind                TransitionKind `json:"kind"`
+	Time                time.Time      `json:"time"`
+	DeploymentId        string         `json:"deploymentId"`
+	ApplicationName     string         `json:"applicationName"`
+	DeploymentGroupName string         `json:"deploymentGroupName"`
+	Status              string         `json:"status"`
+	InstanceId          string         `json:"instanceId,omitempty"`
+	InstanceName        string         `json:"instanceName,omitempty"`
+	LifecycleEventName  string         `json:"lifecycleEventName,omitempty"`
+	Message             string         `json:"message,omitempty"`
+	LogTail             string         `json:"logTail,omitempty"`
+}
+
+type TransitionFunc func(*Transition)
+
+func newTransition(kind TransitionKind, deployment *codedeploy.DeploymentInfo) *Transition {
+	return &Transition{
+		Kind:                kind,
+		Time:                time.Now(),
+		DeploymentId:        aws.StringValue(deployment.DeploymentId),
+		ApplicationName:     aws.StringValue(deployment.ApplicationName),
+		DeploymentGroupName: aws.StringValue(deployment.DeploymentGroupName),
+		Status:              aws.StringValue(deployment.Status),
+	}
+}
+
+// deploymentTransition compares the previously known state of a deployment,
+// nil if it was unknown, with its current state
+func deploymentTransition(prev, deployment *codedeploy.DeploymentInfo) *Transition {
+	status := aws.StringValue(deployment.Status)
+
+	prevStatus := ""
+	if prev != nil {
+		prevStatus = aws.StringValue(prev.Status)
+	}
+
+	if status == prevStatus {
+		return nil
+	}
+
+	var kind TransitionKind
+	switch status {
+	case "InProgress":
+		kind = DeploymentStarted
+	case "Succeeded":
+		kind = DeploymentSucceeded
+	case "Failed":
+		kind = DeploymentFailed
+	case "Stopped":
+		kind = DeploymentStopped
+	default:
+		return nil
+	}
+
+	// deployments that were already finished when we first saw them
+	// did not transition while we were watching
+	if prev == nil && kind != DeploymentStarted {
+		return nil
+	}
+
+	t := newTransition(kind, deployment)
+	if deployment.ErrorInformation != nil {
+		t.Message = aws.StringValue(deployment.ErrorInformation.Message)
+	}
+
+	return t
+}
+
+// lifecycleTransitions compares the previously known summary of an
+// instance, nil if it was unknown, with its current summary
+func lifecycleTransitions(deployment *codedeploy.DeploymentInfo, prev, summary *codedeploy.InstanceSummary) []*Transition {
+	transitions := []*Transition{}
+
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		if aws.StringValue(lifecycleEvent.Status) != "Failed" {
+			continue
+		}
+
+		name := aws.StringValue(lifecycleEvent.LifecycleEventName)
+		if prev != nil && lifecycleEventStatus(prev, name) == "Failed" {
+			continue
+		}
+
+		t := newTransition(LifecycleEventFailed, deployment)
+		t.InstanceId = instanceIdFromArn(aws.StringValue(summary.InstanceId))
+		t.LifecycleEventName = name
+		if lifecycleEvent.Diagnostics != nil {
+			t.Message = aws.StringValue(lifecycleEvent.Diagnostics.Message)
+			t.LogTail = aws.StringValue(lifecycleEvent.Diagnostics.LogTail)
+		}
+
+		transitions = append(transitions, t)
+	}
+
+	return transitions
+}
+
+func lifecycleEventStatus(summary *codedeploy.InstanceSummary, name string) string {
+	for _, lifecycleEvent := range summary.LifecycleEvents {
+		if aws.StringValue(lifecycleEvent.LifecycleEventName) == name {
+			return aws.StringValue(lifecycleEvent.Status)
+		}
+	}
+	return ""
+}
+
+// instanceIdFromArn extracts the instance id from the instance arn
+// used by instance summaries
+func instanceIdFromArn(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
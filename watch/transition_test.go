@@ -0,0 +1,219 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/elb"
+)
+
+func TestDeploymentTransition(t *testing.T) {
+	deployment := func(status string) *codedeploy.DeploymentInfo {
+		if status == "" {
+			return nil
+		}
+		return &codedeploy.DeploymentInfo{
+			DeploymentId:        aws.String("d-1"),
+			ApplicationName:     aws.String("web"),
+			DeploymentGroupName: aws.String("prod"),
+			Status:              aws.String(status),
+		}
+	}
+
+	for _, tt := range []struct {
+		prev   string
+		status string
+		kind   TransitionKind
+	}{
+		{"", "InProgress", DeploymentStarted},
+		{"Created", "InProgress", DeploymentStarted},
+		{"InProgress", "Succeeded", DeploymentSucceeded},
+		{"InProgress", "Failed", DeploymentFailed},
+		{"InProgress", "Stopped", DeploymentStopped},
+		{"Created", "Succeeded", DeploymentSucceeded},
+		// no change
+		{"InProgress", "InProgress", ""},
+		// statuses without a transition
+		{"Created", "Queued", ""},
+		{"Queued", "Ready", ""},
+		// already finished when first seen
+		{"", "Succeeded", ""},
+		{"", "Failed", ""},
+		{"", "Stopped", ""},
+	} {
+		transition := deploymentTransition(deployment(tt.prev), deployment(tt.status))
+
+		var kind TransitionKind
+		if transition != nil {
+			kind = transition.Kind
+			if transition.DeploymentId != "d-1" || transition.ApplicationName != "web" ||
+				transition.DeploymentGroupName != "prod" || transition.Status != tt.status {
+				t.Errorf("deploymentTransition(%q, %q) => %+v", tt.prev, tt.status, transition)
+			}
+		}
+
+		if kind != tt.kind {
+			t.Errorf("deploymentTransition(%q, %q) => %q, want %q", tt.prev, tt.status, kind, tt.kind)
+		}
+	}
+
+	failed := deployment("Failed")
+	failed.ErrorInformation = &codedeploy.ErrorInformation{Message: aws.String("too many failed instances")}
+	if transition := deploymentTransition(deployment("InProgress"), failed); transition.Message != "too many failed instances" {
+		t.Errorf("deploymentTransition() message => %q, want the error information", transition.Message)
+	}
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	deployment := &codedeploy.DeploymentInfo{DeploymentId: aws.String("d-1"), Status: aws.String("InProgress")}
+
+	summary := func(statuses ...string) *codedeploy.InstanceSummary {
+		if len(statuses) == 0 {
+			return nil
+		}
+		names := []string{"BeforeInstall", "Install", "ValidateService"}
+		summary := &codedeploy.InstanceSummary{InstanceId: aws.String("arn:aws:ec2:us-east-1:123:instance/i-1")}
+		for i, status := range statuses {
+			lifecycleEvent := &codedeploy.LifecycleEvent{
+				LifecycleEventName: aws.String(names[i]),
+				Status:             aws.String(status),
+			}
+			if status == "Failed" {
+				lifecycleEvent.Diagnostics = &codedeploy.Diagnostics{
+					Message: aws.String("Script returned with exit code 1"),
+					LogTail: aws.String("[stderr] boom"),
+				}
+			}
+			summary.LifecycleEvents = append(summary.LifecycleEvents, lifecycleEvent)
+		}
+		return summary
+	}
+
+	for _, tt := range []struct {
+		prev    *codedeploy.InstanceSummary
+		summary *codedeploy.InstanceSummary
+		names   string
+	}{
+		{nil, summary("Succeeded", "InProgress"), ""},
+		{nil, summary("Succeeded", "Failed"), "Install"},
+		{summary("Succeeded", "InProgress"), summary("Succeeded", "Failed"), "Install"},
+		// already failed
+		{summary("Succeeded", "Failed"), summary("Succeeded", "Failed"), ""},
+		// every newly failed event
+		{summary("Succeeded", "Failed", "Pending"), summary("Succeeded", "Failed", "Failed"), "ValidateService"},
+		{summary("InProgress"), summary("Failed", "Failed", "Failed"), "BeforeInstall,Install,ValidateService"},
+	} {
+		transitions := lifecycleTransitions(deployment, tt.prev, tt.summary)
+
+		names := []string{}
+		for _, transition := range transitions {
+			names = append(names, transition.LifecycleEventName)
+			if transition.Kind != LifecycleEventFailed || transition.InstanceId != "i-1" ||
+				transition.Message != "Script returned with exit code 1" || transition.LogTail != "[stderr] boom" {
+				t.Errorf("lifecycleTransitions() => %+v", transition)
+			}
+		}
+
+		if strings.Join(names, ",") != tt.names {
+			t.Errorf("lifecycleTransitions(%s) => %v, want %s", tt.summary, names, tt.names)
+		}
+	}
+}
+
+type fakeTransitionAws struct {
+	fakeAws
+}
+
+func (f *fakeTransitionAws) GetDeploymentGroup(applicationName, deploymentGroupName string) (*codedeploy.DeploymentGroupInfo, error) {
+	return &codedeploy.DeploymentGroupInfo{
+		ApplicationName:     aws.String(applicationName),
+		DeploymentGroupName: aws.String(deploymentGroupName),
+		LoadBalancerInfo: &codedeploy.LoadBalancerInfo{
+			ElbInfoList: []*codedeploy.ELBInfo{{Name: aws.String("web-elb")}},
+		},
+		AlarmConfiguration: &codedeploy.AlarmConfiguration{
+			Enabled: aws.Bool(true),
+			Alarms:  []*codedeploy.Alarm{{Name: aws.String("cpu-high")}},
+		},
+	}, nil
+}
+
+func (f *fakeTransitionAws) DescribeInstanceHealth(string) ([]*elb.InstanceState, error) {
+	return []*elb.InstanceState{{
+		InstanceId:  aws.String("i-1"),
+		State:       aws.String("OutOfService"),
+		Description: aws.String("Instance has failed at least the UnhealthyThreshold number of health checks"),
+	}}, nil
+}
+
+func (f *fakeTransitionAws) DescribeAlarms([]string) ([]*cloudwatch.MetricAlarm, error) {
+	return []*cloudwatch.MetricAlarm{{
+		AlarmName:   aws.String("cpu-high"),
+		StateValue:  aws.String("ALARM"),
+		StateReason: aws.String("Threshold Crossed"),
+	}}, nil
+}
+
+func TestRendererTransitions(t *testing.T) {
+	a := &fakeTransitionAws{}
+	now := time.Now()
+
+	for _, tt := range []struct {
+		kind    TransitionKind
+		status  string
+		update  func(*Renderer) error
+		message string
+	}{
+		{InstanceStuck, "InProgress", func(r *Renderer) error {
+			r.CheckStragglers()
+			return nil
+		}, "11m "},
+		{InstanceUnhealthy, "Succeeded", func(r *Renderer) error {
+			return r.AddTargetHealth(a, "d-1", nil)
+		}, "OutOfService in web-elb: Instance has failed at least the UnhealthyThreshold number of health checks"},
+		{AlarmTriggered, "InProgress", func(r *Renderer) error {
+			return r.AddAlarms(a, "d-1")
+		}, "alarm cpu-high is in ALARM, CodeDeploy will stop the deployment: Threshold Crossed"},
+	} {
+		renderer := NewRenderer(false, false, NewStragglerDetector(3.0, 10*time.Minute))
+		renderer.Deployments = append(renderer.Deployments, &codedeploy.DeploymentInfo{
+			DeploymentId:        aws.String("d-1"),
+			ApplicationName:     aws.String("web"),
+			DeploymentGroupName: aws.String("prod"),
+			Status:              aws.String("InProgress"),
+		})
+		renderer.DeploymentInstanceMap["d-1"] = NewSet()
+		renderer.DeploymentInstanceMap["d-1"].Add("i-1")
+		renderer.InstanceSummaries["i-1"] = &codedeploy.InstanceSummary{
+			DeploymentId: aws.String("d-1"),
+			InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/i-1"),
+			Status:       aws.String(tt.status),
+			LifecycleEvents: []*codedeploy.LifecycleEvent{
+				testLifecycleEvent("ValidateService", tt.status, now.Add(-11*time.Minute), -1),
+			},
+		}
+
+		transitions := []*Transition{}
+		renderer.OnTransition(func(t *Transition) {
+			transitions = append(transitions, t)
+		})
+
+		// a second update of the same state is not a new transition
+		for i := 0; i < 2; i++ {
+			if err := tt.update(renderer); err != nil {
+				t.Fatalf("%s update => %s", tt.kind, err)
+			}
+		}
+
+		if len(transitions) != 1 || transitions[0].Kind != tt.kind || transitions[0].DeploymentId != "d-1" {
+			t.Fatalf("%s update => %v, want a single %s transition", tt.kind, transitions, tt.kind)
+		}
+		if !strings.HasPrefix(transitions[0].Message, tt.message) {
+			t.Errorf("%s message => %q, want %q...", tt.kind, transitions[0].Message, tt.message)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package watch tracks the state of AWS CodeDeploy deployments and their
+// instances, and publishes every change as a typed event. The deploywatch
+// command is one consumer of it.
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// Watcher watches CodeDeploy deployments: its poller fetches their state
+// from aws into its renderer, which publishes every change as an event
+//
+//	watcher := watch.NewWatcher(watch.NewAwsEnv(), renderer, nil, "myapp", []string{"production"}, 0)
+//	events := watcher.Subscribe(16)
+//	watcher.Start(ctx)
+//	for e := range events {
+//		...
+//	}
+type Watcher struct {
+	Renderer *Renderer
+	Poller   *Poller
+	Checker  *Checker
+}
+
+// NewWatcher creates a watcher for the running deployments of the named
+// application's deployment groups, if any are given, along with any
+// deployments added by id. A nil logger discards log output.
+func NewWatcher(aws Aws, renderer *Renderer, logger *log.Logger, name string, groups []string, history time.Duration) *Watcher {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	checker := NewChecker(logger)
+	return &Watcher{
+		renderer,
+		NewPoller(aws, renderer, checker, logger, name, groups, history),
+		checker,
+	}
+}
+
+// Add starts watching deployments by id
+func (w *Watcher) Add(deploymentIds ...string) {
+	for _, deploymentId := range deploymentIds {
+		w.Poller.Add(deploymentId)
+	}
+}
+
+// Subscribe returns a channel receiving every event from now on, which is
+// closed once the watcher stops. Publishing never waits for subscribers:
+// while the channel's buffer is full, events are dropped for it, so a slow
+// consumer loses events and should size buffer for bursts. Bus().Dropped()
+// counts the events lost.
+func (w *Watcher) Subscribe(buffer int) <-chan Event {
+	return w.Renderer.Bus().Subscribe(buffer)
+}
+
+// OnTransition registers fn to be called with every notable transition
+func (w *Watcher) OnTransition(fn TransitionFunc) {
+	w.Renderer.OnTransition(fn)
+}
+
+// Snapshot returns the current state of every watched deployment
+func (w *Watcher) Snapshot() *Snapshot {
+	return w.Renderer.Snapshot()
+}
+
+// Start begins polling in the background, until ctx is done
+func (w *Watcher) Start(ctx context.Context) {
+	w.Poller.Start()
+
+	go func() {
+		<-ctx.Done()
+		w.Checker.Quit()
+		w.Renderer.Bus().Close()
+	}()
+}
@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// fakeAws serves a single deployment of a single instance
+type fakeAws struct{}
+
+func (f *fakeAws) ListDeployments(string, string, []string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (f *fakeAws) ListDeploymentsCreatedBetween(string, string, []string, time.Time, time.Time) ([]string, error) {
+	return []string{}, nil
+}
+
+func (f *fakeAws) GetDeployment(deploymentId string) (*codedeploy.DeploymentInfo, error) {
+	return &codedeploy.DeploymentInfo{
+		DeploymentId:        aws.String(deploymentId),
+		ApplicationName:     aws.String("web"),
+		DeploymentGroupName: aws.String("prod"),
+		Status:              aws.String("InProgress"),
+	}, nil
+}
+
+func (f *fakeAws) GetDeploymentConfig(string) (*codedeploy.DeploymentConfigInfo, error) {
+	return &codedeploy.DeploymentConfigInfo{}, nil
+}
+
+func (f *fakeAws) GetApplicationRevision(string, *codedeploy.RevisionLocation) (*codedeploy.GenericRevisionInfo, error) {
+	return &codedeploy.GenericRevisionInfo{}, nil
+}
+
+func (f *fakeAws) ListDeploymentInstances(string) ([]string, error) {
+	return []string{"i-1"}, nil
+}
+
+func (f *fakeAws) DescribeInstances(instanceIds []string) ([]*ec2.Instance, error) {
+	instances := []*ec2.Instance{}
+	for _, instanceId := range instanceIds {
+		instances = append(instances, &ec2.Instance{InstanceId: aws.String(instanceId)})
+	}
+	return instances, nil
+}
+
+func (f *fakeAws) FilterInstances([]*ec2.Filter) ([]*ec2.Instance, error) {
+	return []*ec2.Instance{}, nil
+}
+
+func (f *fakeAws) BatchGetDeploymentInstances(deploymentId string, instanceIds []string) ([]*codedeploy.InstanceSummary, error) {
+	summaries := []*codedeploy.InstanceSummary{}
+	for _, instanceId := range instanceIds {
+		summaries = append(summaries, &codedeploy.InstanceSummary{
+			DeploymentId: aws.String(deploymentId),
+			InstanceId:   aws.String("arn:aws:ec2:us-east-1:123:instance/" + instanceId),
+			Status:       aws.String("InProgress"),
+		})
+	}
+	return summaries, nil
+}
+
+func (f *fakeAws) GetDeploymentGroup(applicationName, deploymentGroupName string) (*codedeploy.DeploymentGroupInfo, error) {
+	return &codedeploy.DeploymentGroupInfo{
+		ApplicationName:     aws.String(applicationName),
+		DeploymentGroupName: aws.String(deploymentGroupName),
+	}, nil
+}
+
+func (f *fakeAws) DescribeAutoScalingGroups([]string) ([]*autoscaling.Group, error) {
+	return []*autoscaling.Group{}, nil
+}
+
+func (f *fakeAws) DescribeScalingActivities(string) ([]*autoscaling.Activity, error) {
+	return []*autoscaling.Activity{}, nil
+}
+
+func (f *fakeAws) DescribeInstanceHealth(string) ([]*elb.InstanceState, error) {
+	return []*elb.InstanceState{}, nil
+}
+
+func (f *fakeAws) DescribeTargetHealth(string) ([]*elbv2.TargetHealthDescription, error) {
+	return []*elbv2.TargetHealthDescription{}, nil
+}
+
+func (f *fakeAws) DescribeAlarms([]string) ([]*cloudwatch.MetricAlarm, error) {
+	return []*cloudwatch.MetricAlarm{}, nil
+}
+
+func (f *fakeAws) DescribeLogStreams(string, string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (f *fakeAws) FilterLogEvents(string, []string, time.Time, time.Time, *string) ([]*cloudwatchlogs.FilteredLogEvent, *string, error) {
+	return []*cloudwatchlogs.FilteredLogEvent{}, nil, nil
+}
+
+func (f *fakeAws) SendCommand(string, []string, string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeAws) GetCommandInvocation(string, string) (string, string, error) {
+	return "", "", nil
+}
+
+func (f *fakeAws) GetPipeline(string) (*codepipeline.PipelineDeclaration, error) {
+	return &codepipeline.PipelineDeclaration{}, nil
+}
+
+func (f *fakeAws) GetPipelineState(string) (*codepipeline.GetPipelineStateOutput, error) {
+	return &codepipeline.GetPipelineStateOutput{}, nil
+}
+
+func (f *fakeAws) GetPipelineExecution(string, string) (*codepipeline.PipelineExecution, error) {
+	return &codepipeline.PipelineExecution{}, nil
+}
+
+func (f *fakeAws) LatestPipelineExecution(string) (string, error) {
+	return "", nil
+}
+
+func TestWatcher(t *testing.T) {
+	watcher := NewWatcher(&fakeAws{}, NewRenderer(false, false, nil), nil, "", []string{}, 0)
+	watcher.Poller.DeploymentInterval = 10 * time.Millisecond
+	watcher.Poller.InstanceInterval = 10 * time.Millisecond
+	watcher.Poller.SummaryInterval = 10 * time.Millisecond
+	watcher.Add("d-1")
+	events := watcher.Subscribe(100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher.Start(ctx)
+
+	discovered := false
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			switch e := e.(type) {
+			case *DeploymentDiscovered:
+				discovered = e.DeploymentId == "d-1"
+			case *InstanceStatusChanged:
+				if !discovered {
+					t.Fatalf("instance status changed before the deployment was discovered")
+				}
+				if e.InstanceId != "i-1" || e.To != "InProgress" {
+					t.Errorf("InstanceStatusChanged => %s", e)
+				}
+
+				snapshot := watcher.Snapshot().Deployment("d-1")
+				if snapshot == nil || len(snapshot.Instances) != 1 {
+					t.Errorf("Snapshot() => %+v", snapshot)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for events")
+		}
+	}
+}
+
+func TestWatcherSubscribeEnds(t *testing.T) {
+	watcher := NewWatcher(&fakeAws{}, NewRenderer(false, false, nil), nil, "", []string{}, 0)
+	watcher.Poller.DeploymentInterval = 10 * time.Millisecond
+	watcher.Poller.InstanceInterval = 10 * time.Millisecond
+	watcher.Poller.SummaryInterval = 10 * time.Millisecond
+	watcher.Add("d-1")
+	events := watcher.Subscribe(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher.Start(ctx)
+
+	done := make(chan bool)
+	go func() {
+		for range events {
+		}
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cancel()
+		t.Fatalf("ranging over events did not end after cancel")
+	}
+
+	if _, ok := <-watcher.Subscribe(1); ok {
+		t.Errorf("Subscribe() after stopping => open channel")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+// DefaultMessageTemplate formats a transition as a single line of text
+const DefaultMessageTemplate = `{{.Kind}}: {{.ApplicationName}}-{{.DeploymentGroupName}} {{.DeploymentId}}` +
+	`{{if .InstanceId}} {{if .InstanceName}}{{.InstanceName}} ({{.InstanceId}}){{else}}{{.InstanceId}}{{end}}{{end}}` +
+	`{{if .LifecycleEventName}} {{.LifecycleEventName}}{{end}}{{if .Message}}: {{.Message}}{{end}}`
+
+// Webhook posts transitions to an http endpoint, either as a generic
+// json document or as a slack-compatible message
+type Webhook struct {
+	URL     string
+	Slack   bool
+	Kinds   map[watch.TransitionKind]bool
+	Retries int
+	Backoff time.Duration
+
+	message *template.Template
+	client  *http.Client
+	logger  *log.Logger
+}
+
+// NewWebhook creates a webhook for the given kinds of transitions,
+// all kinds if none are given, with messages formatted by messageTemplate
+func NewWebhook(url string, slack bool, messageTemplate string, kinds []watch.TransitionKind, logger *log.Logger) (*Webhook, error) {
+	message, err := template.New("message").Parse(messageTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{
+		URL:     url,
+		Slack:   slack,
+		Kinds:   map[watch.TransitionKind]bool{},
+		Retries: 3,
+		Backoff: time.Second,
+		message: message,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		logger:  logger,
+	}
+	for _, kind := range kinds {
+		w.Kinds[kind] = true
+	}
+
+	return w, nil
+}
+
+// Notify sends the transition in the background, if the webhook wants it
+func (w *Webhook) Notify(t *watch.Transition) {
+	if len(w.Kinds) > 0 && !w.Kinds[t.Kind] {
+		return
+	}
+
+	go func() {
+		err := w.Send(t)
+		if err != nil {
+			w.logger.Printf("Error sending webhook %s to %s: %s\n", t.Kind, w.URL, err)
+		}
+	}()
+}
+
+// Send posts the transition, retrying network errors, server errors and
+// rate limited attempts with exponential backoff
+func (w *Webhook) Send(t *watch.Transition) error {
+	body, err := w.payload(t)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the body once, reporting whether a failed attempt is worth retrying
+func (w *Webhook) post(body []byte) (bool, error) {
+	resp, err := w.client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+func (w *Webhook) payload(t *watch.Transition) ([]byte, error) {
+	var message bytes.Buffer
+	err := w.message.Execute(&message, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Slack {
+		return json.Marshal(map[string]string{"text": message.String()})
+	}
+
+	return json.Marshal(struct {
+		Text       string            `json:"text"`
+		Transition *watch.Transition `json:"transition"`
+	}{message.String(), t})
+}
+
+// ParseTransitionKinds parses a csv of transition kinds, empty for all kinds
+func ParseTransitionKinds(csv string) ([]watch.TransitionKind, error) {
+	kinds := []watch.TransitionKind{}
+	for _, name := range strings.Split(csv, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, kind := range watch.TransitionKinds {
+			if string(kind) == name {
+				kinds = append(kinds, kind)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event %q", name)
+		}
+	}
+	return kinds, nil
+}
+
+// registerWebhooks sends renderer transitions to the webhooks named by the cli flags
+func registerWebhooks(renderer *watch.Renderer, logger *log.Logger) error {
+	kinds, err := ParseTransitionKinds(*webhookEventsFlag)
+	if err != nil {
+		return err
+	}
+
+	urls := map[string]bool{}
+	for _, url := range webhookFlag {
+		urls[url] = false
+	}
+	for _, url := range slackWebhookFlag {
+		urls[url] = true
+	}
+
+	for url, slack := range urls {
+		webhook, err := NewWebhook(url, slack, *webhookTemplateFlag, kinds, logger)
+		if err != nil {
+			return err
+		}
+		webhook.Retries = *webhookRetriesFlag
+		renderer.OnTransition(webhook.Notify)
+	}
+
+	return nil
+}
+
+// stringsFlag is a flag that may be given more than once
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
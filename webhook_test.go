@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atongen/deploywatch/watch"
+)
+
+func testTransition() *watch.Transition {
+	return &watch.Transition{
+		Kind:                watch.LifecycleEventFailed,
+		DeploymentId:        "d-1",
+		ApplicationName:     "app",
+		DeploymentGroupName: "group",
+		Status:              "InProgress",
+		InstanceId:          "i-1",
+		InstanceName:        "web-1",
+		LifecycleEventName:  "ValidateService",
+		Message:             "Script returned with exit code 1",
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		body     map[string]interface{}
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts += 1
+		if attempts < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer ts.Close()
+
+	logger := log.New(ioutil.Discard, "", 0)
+
+	webhook, err := NewWebhook(ts.URL, false, DefaultMessageTemplate, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.Backoff = 0
+
+	err = webhook.Send(testTransition())
+	if err != nil {
+		t.Fatalf("Send() => %s, want success after retries", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Send() made %d attempts, want 3", attempts)
+	}
+
+	text := "lifecycle_event.failed: app-group d-1 web-1 (i-1) ValidateService: Script returned with exit code 1"
+	if body["text"] != text {
+		t.Errorf("Send() text => %q, want %q", body["text"], text)
+	}
+
+	transition, ok := body["transition"].(map[string]interface{})
+	if !ok || transition["lifecycleEventName"] != "ValidateService" {
+		t.Errorf("Send() transition => %v", body["transition"])
+	}
+
+	webhook.Retries = 0
+	attempts = 0
+	err = webhook.Send(testTransition())
+	if err == nil {
+		t.Errorf("Send() without retries should fail")
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+
+	for _, tt := range []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusInternalServerError, 3},
+		{http.StatusBadGateway, 3},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusUnauthorized, 1},
+	} {
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			attempts += 1
+			w.WriteHeader(tt.status)
+		}))
+
+		webhook, err := NewWebhook(ts.URL, false, DefaultMessageTemplate, nil, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		webhook.Backoff = 0
+		webhook.Retries = 2
+
+		err = webhook.Send(testTransition())
+		ts.Close()
+
+		if err == nil || attempts != tt.attempts {
+			t.Errorf("Send() with status %d => %d attempts, %v, want %d attempts and an error", tt.status, attempts, err, tt.attempts)
+		}
+	}
+
+	// network errors are retried too
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	webhook, err := NewWebhook(ts.URL, false, DefaultMessageTemplate, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.Backoff = time.Millisecond
+	webhook.Retries = 2
+
+	start := time.Now()
+	err = webhook.Send(testTransition())
+	if err == nil || time.Since(start) < 3*time.Millisecond {
+		t.Errorf("Send() to a closed server => %v after %s, want an error after retrying", err, time.Since(start))
+	}
+}
+
+func TestWebhookSlack(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer ts.Close()
+
+	webhook, err := NewWebhook(ts.URL, true, "{{.Kind}} {{.DeploymentId}}", []watch.TransitionKind{watch.LifecycleEventFailed}, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// filtered out, never sent
+	stuck := testTransition()
+	stuck.Kind = watch.InstanceStuck
+	webhook.Notify(stuck)
+
+	webhook.Notify(testTransition())
+
+	body := <-bodies
+	if len(body) != 1 || body["text"] != "lifecycle_event.failed d-1" {
+		t.Errorf("Notify() slack body => %v", body)
+	}
+}
+
+func TestParseTransitionKinds(t *testing.T) {
+	kinds, err := ParseTransitionKinds("deployment.failed, instance.stuck")
+	if err != nil || len(kinds) != 2 || kinds[0] != watch.DeploymentFailed || kinds[1] != watch.InstanceStuck {
+		t.Errorf("ParseTransitionKinds() => %v %v", kinds, err)
+	}
+
+	_, err = ParseTransitionKinds("deployment.exploded")
+	if err == nil {
+		t.Errorf("ParseTransitionKinds() should reject unknown events")
+	}
+}